@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"runtime/debug"
+	"slices"
+
+	"github.com/OpenSourcererPrime/shoehorn/config"
+	"github.com/OpenSourcererPrime/shoehorn/entrypoint"
+)
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// dryRunFlags registers the flags that redirect generated outputs away from
+// their configured paths
+func dryRunFlags(flags *flag.FlagSet) (*bool, *string) {
+	dryRun := flags.Bool("dry-run", false, "Write outputs to stdout instead of their configured paths, without starting the process")
+	outputRoot := flags.String("output-root", "", "Write outputs beneath this directory instead of their configured paths, implies --dry-run")
+	return dryRun, outputRoot
+}
+
+// dryRun generates every output to stdout, or beneath outputRoot if it is set
+func dryRun(appConfig *config.Config, outputRoot string) int {
+	var err error
+	if outputRoot != "" {
+		err = entrypoint.GenerateAllUnder(appConfig, outputRoot)
+	} else {
+		err = entrypoint.RenderAllTo(appConfig, os.Stdout)
+	}
+
+	if err != nil {
+		slog.Error("Failed to render outputs", "error", err)
+		return exitRenderFailed
+	}
+	return exitOK
+}
+
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	dryRunEnabled, outputRoot := dryRunFlags(flags)
+	if err := flags.Parse(args); err != nil || flags.NArg() < 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+
+	configPath := flags.Arg(0)
+	extraArgs := flags.Args()[1:]
+
+	appConfig, err := config.LoadConfigFile(configPath)
+	if err != nil {
+		slog.Error("Failed to load config", "config", configPath, "error", err)
+		return exitInvalidConfig
+	}
+	slog.SetDefault(newLogger(appConfig.Log, os.Stderr))
+	slog.Info("Starting shoehorn", "config", configPath, "version", version)
+
+	if *dryRunEnabled || *outputRoot != "" {
+		return dryRun(appConfig, *outputRoot)
+	}
+	appConfig.Process.Args = append(appConfig.Process.Args, extraArgs...)
+
+	ep, err := entrypoint.NewEntryPoint(appConfig)
+	if err != nil {
+		slog.Error("Failed to create entrypoint", "error", err)
+		return exitError
+	}
+	defer ep.Close()
+
+	err = ep.GenerateOutputs()
+	if err != nil {
+		// The outputs are generated again once their inputs change
+		slog.Warn("Failed to generate outputs", "error", err)
+	}
+
+	err = ep.Serve()
+	if err != nil {
+		slog.Error("Failed to serve HTTP endpoints", "error", err)
+		return exitError
+	}
+
+	err = ep.ServeControl()
+	if err != nil {
+		slog.Error("Failed to serve control socket", "error", err)
+		return exitError
+	}
+
+	// Start the managed process
+	err = ep.StartManagedProcess()
+	if err != nil {
+		slog.Error("Failed to start managed process", "error", err)
+		return exitError
+	}
+
+	// Watch for changes to the inputs and to the config itself in a
+	// separate goroutine
+	ep.WatchConfig(configPath, extraArgs)
+	go ep.WatchForChanges()
+
+	// Handle signals for graceful termination
+	err = ep.HandleSignals()
+	if err != nil {
+		return exitError
+	}
+	return exitOK
+}
+
+func renderCommand(args []string) int {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	dryRunEnabled, outputRoot := dryRunFlags(flags)
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+
+	appConfig, err := config.LoadConfigFile(flags.Arg(0))
+	if err != nil {
+		slog.Error("Failed to load config", "config", flags.Arg(0), "error", err)
+		return exitInvalidConfig
+	}
+	slog.SetDefault(newLogger(appConfig.Log, os.Stderr))
+
+	if *dryRunEnabled || *outputRoot != "" {
+		return dryRun(appConfig, *outputRoot)
+	}
+
+	err = entrypoint.GenerateAll(appConfig)
+	if err != nil {
+		slog.Error("Failed to render outputs", "error", err)
+		return exitRenderFailed
+	}
+	return exitOK
+}
+
+func validateCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+
+	appConfig, err := config.LoadConfigFile(args[0])
+	if err != nil {
+		slog.Error("Invalid config", "error", err)
+		return exitInvalidConfig
+	}
+
+	err = entrypoint.ValidateTemplates(appConfig)
+	if err != nil {
+		slog.Error("Invalid template", "error", err)
+		return exitInvalidConfig
+	}
+
+	slog.Info("Config is valid", "config", args[0])
+	return exitOK
+}
+
+func diffCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+
+	appConfig, err := config.LoadConfigFile(args[0])
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitInvalidConfig
+	}
+
+	changed := false
+	for _, gen := range appConfig.Generate {
+		outputs, err := entrypoint.RenderOutputs(gen)
+		if err != nil {
+			slog.Error("Failed to render output", "name", gen.Name, "output", entrypoint.OutputPath(gen), "error", err)
+			return exitRenderFailed
+		}
+
+		// Files the directory strategy would remove are shown as emptied
+		for _, stalePath := range entrypoint.StaleOutputs(gen, outputs) {
+			outputs[stalePath] = nil
+		}
+
+		for _, outputPath := range slices.Sorted(maps.Keys(outputs)) {
+			rendered := outputs[outputPath]
+			current, err := os.ReadFile(outputPath)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				slog.Error("Failed to read output file", "name", gen.Name, "output", outputPath, "error", err)
+				return exitError
+			}
+
+			if string(current) != string(rendered) {
+				changed = true
+				diff := unifiedDiff(outputPath, string(current), string(rendered))
+				if diff == "" {
+					diff = fmt.Sprintf("%s differs only in its trailing newline\n", outputPath)
+				}
+				fmt.Print(diff)
+			}
+		}
+	}
+
+	if changed {
+		return exitDiffFound
+	}
+	return exitOK
+}
+
+func ctlCommand(args []string) int {
+	flags := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	socket := flags.String("socket", defaultControlSocket, "Path of the control socket of the running shoehorn")
+	if err := flags.Parse(args); err != nil || flags.NArg() < 1 || flags.NArg() > 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+
+	req := entrypoint.ControlRequest{Command: flags.Arg(0), Output: flags.Arg(1)}
+	resp, err := entrypoint.Control(*socket, req)
+	if resp != nil {
+		printControlResponse(os.Stdout, resp)
+	}
+	if err != nil {
+		slog.Error("Control command failed", "command", req.Command, "error", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func schemaCommand(args []string) int {
+	schema, err := config.MarshalSchema()
+	if err != nil {
+		slog.Error("Failed to generate schema", "error", err)
+		return exitError
+	}
+
+	os.Stdout.Write(schema)
+	return exitOK
+}
+
+func versionCommand(args []string) int {
+	revision := "unknown"
+	goVersion := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		goVersion = info.GoVersion
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				revision = setting.Value
+			}
+		}
+	}
+
+	fmt.Printf("shoehorn %s (revision %s, %s)\n", version, revision, goVersion)
+	return exitOK
+}
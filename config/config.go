@@ -1,38 +1,194 @@
 package config
 
 import (
-	"errors"
+	"fmt"
 	"io"
-	"log"
-
-	"github.com/goccy/go-yaml"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
+	Include  []string         `yaml:"include"` // Paths or globs of config fragments to merge
 	Generate []GenerateConfig `yaml:"generate"`
 	Process  ProcessConfig    `yaml:"process"`
+	Watch    WatchConfig      `yaml:"watch"`
+	Metrics  MetricsConfig    `yaml:"metrics"`
+	Health   HealthConfig     `yaml:"health"`
+	Log      LogConfig        `yaml:"log"`
+	Hooks    HooksConfig      `yaml:"hooks"`
+	Control  ControlConfig    `yaml:"control"`
+
+	sources        []string
+	sourcePatterns []string // Globs matching fragments that would be merged once created
+}
+
+// Sources returns the files and directories the config was loaded from,
+// including every fragment it includes
+func (c *Config) Sources() []string {
+	return c.sources
+}
+
+// IsSource reports whether the file at path is one of the sources of the
+// config, or a fragment that would be merged into it once created. Hidden
+// files, such as editor swap and lock files, are never fragments.
+func (c *Config) IsSource(path string) bool {
+	path = filepath.Clean(path)
+	for _, source := range c.sources {
+		if filepath.Clean(source) == path {
+			return true
+		}
+	}
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return false
+	}
+	for _, pattern := range c.sourcePatterns {
+		if ok, _ := filepath.Match(filepath.Clean(pattern), path); ok {
+			return true
+		}
+	}
+	return false
 }
 
 // GenerateConfig represents a configuration for generating files
 type GenerateConfig struct {
-	Name     string      `yaml:"name"`
-	Path     string      `yaml:"path"`
-	Strategy string      `yaml:"strategy"` // "append" or "template"
-	Template string      `yaml:"template"` // Used when strategy=template
-	Inputs   []InputFile `yaml:"inputs"`
+	Name            string        `yaml:"name"`
+	Path            string        `yaml:"path"`
+	Strategy        string        `yaml:"strategy"` // "append", "template" or "directory"
+	Template        string        `yaml:"template"` // Template file, or source tree when strategy=directory
+	Inputs          []InputFile   `yaml:"inputs"`
+	Mode            FileMode      `yaml:"mode"`            // E.g., "0640", defaults to 0644
+	DirMode         FileMode      `yaml:"dirMode"`         // Mode for created directories, defaults to 0755
+	Owner           string        `yaml:"owner"`           // User name or uid of the output file
+	Group           string        `yaml:"group"`           // Group name or gid of the output file
+	RefreshInterval time.Duration `yaml:"refreshInterval"` // Render again on this interval even without changes
+}
+
+// FileMode is an octal permission mode that can be written in YAML either
+// as a quoted string ("0640") or as a bare number (0640)
+type FileMode os.FileMode
+
+func (m *FileMode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	var value uint64
+	switch v := raw.(type) {
+	case string:
+		parsed, err := strconv.ParseUint(strings.TrimPrefix(v, "0o"), 8, 32)
+		if err != nil {
+			return &ErrorInvalidMode{Value: v}
+		}
+		value = parsed
+	case uint64:
+		value = v
+	case int64:
+		if v < 0 {
+			return &ErrorInvalidMode{Value: strconv.FormatInt(v, 10)}
+		}
+		value = uint64(v)
+	default:
+		return &ErrorInvalidMode{Value: fmt.Sprint(raw)}
+	}
+
+	if value > 0o7777 {
+		return &ErrorInvalidMode{Value: fmt.Sprintf("%o", value)}
+	}
+	*m = FileMode(value)
+	return nil
+}
+
+// OrDefault returns the mode as an os.FileMode, or def if it was not set
+func (m FileMode) OrDefault(def os.FileMode) os.FileMode {
+	if m == 0 {
+		return def
+	}
+	return os.FileMode(m)
 }
 
 // InputFile represents an input file to be watched
 type InputFile struct {
 	Name string `yaml:"name"`
-	Path string `yaml:"path"`
+	Path string `yaml:"path"` // A file, or a directory or glob matching several files
+	Env  string `yaml:"env"`  // Environment variable read instead of a file
 }
 
 // ProcessConfig represents configuration for the managed process
 type ProcessConfig struct {
-	Path   string       `yaml:"path"`
-	Reload ReloadConfig `yaml:"reload"`
-	Args   []string     `yaml:"args"`
+	Path       string        `yaml:"path"`
+	Reload     ReloadConfig  `yaml:"reload"`
+	Args       []string      `yaml:"args"`
+	WorkingDir string        `yaml:"workingDir"` // Defaults to shoehorn's working directory
+	Umask      *FileMode     `yaml:"umask"`      // E.g., "0027", inherited when unset
+	Rlimits    RlimitsConfig `yaml:"rlimits"`
+	// Start the process in its own process group and signal the whole group
+	ProcessGroup bool               `yaml:"processGroup"`
+	HealthCheck  *HealthCheckConfig `yaml:"healthCheck"`
+	Output       OutputConfig       `yaml:"output"`
+}
+
+// OutputConfig represents how the stdout and stderr of the managed process
+// are written
+type OutputConfig struct {
+	Format   string `yaml:"format"`   // "passthrough", "prefix" or "json", defaults to passthrough
+	Name     string `yaml:"name"`     // Name in prefixed and JSON lines, defaults to the base name of the process path
+	File     string `yaml:"file"`     // Also write the output to this file, rotated by size
+	MaxSize  int64  `yaml:"maxSize"`  // Size in bytes at which the file is rotated, defaults to 10 MiB
+	MaxFiles int    `yaml:"maxFiles"` // Number of rotated files kept, defaults to 3
+}
+
+// HealthCheckConfig represents a periodic probe of the managed process
+type HealthCheckConfig struct {
+	ProbeConfig `yaml:",inline"`
+	Interval    time.Duration `yaml:"interval"`    // Defaults to 10s
+	Retries     int           `yaml:"retries"`     // Consecutive failures before acting, defaults to 3
+	StartPeriod time.Duration `yaml:"startPeriod"` // Failures in this period after a start are not counted
+	OnFailure   string        `yaml:"onFailure"`   // "restart" or "unready", defaults to restart
+}
+
+// RlimitsConfig represents resource limits applied to the managed process.
+// Each limit sets both the soft and hard value, unset limits are inherited.
+type RlimitsConfig struct {
+	Nofile  *Rlimit `yaml:"nofile"`
+	Nproc   *Rlimit `yaml:"nproc"`
+	Core    *Rlimit `yaml:"core"`
+	Memlock *Rlimit `yaml:"memlock"`
+}
+
+// RlimitUnlimited is the value of an Rlimit configured as "unlimited"
+const RlimitUnlimited Rlimit = ^Rlimit(0)
+
+// Rlimit is a resource limit that can be written in YAML either as a number
+// or as "unlimited"
+type Rlimit uint64
+
+func (r *Rlimit) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	switch v := raw.(type) {
+	case string:
+		if v == "unlimited" {
+			*r = RlimitUnlimited
+			return nil
+		}
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return &ErrorInvalidRlimit{Value: v}
+		}
+		*r = Rlimit(parsed)
+	case uint64:
+		*r = Rlimit(v)
+	default:
+		return &ErrorInvalidRlimit{Value: fmt.Sprint(raw)}
+	}
+	return nil
 }
 
 // ReloadConfig represents reload configuration for the managed process
@@ -42,35 +198,78 @@ type ReloadConfig struct {
 	Signal  string `yaml:"signal"` // E.g., "SIGHUP"
 }
 
+// WatchConfig represents how inputs are watched for changes
+type WatchConfig struct {
+	Mode           string        `yaml:"mode"`           // "inotify", "poll" or "auto", defaults to inotify
+	PollInterval   time.Duration `yaml:"pollInterval"`   // E.g., "5s", defaults to 2s
+	ResyncInterval time.Duration `yaml:"resyncInterval"` // Regenerate changed outputs periodically, disabled when unset
+}
+
+// MetricsConfig represents the Prometheus metrics endpoint
+type MetricsConfig struct {
+	Listen string `yaml:"listen"` // E.g., ":9090", metrics are not served when unset
+}
+
+// HealthConfig represents the health and readiness endpoints
+type HealthConfig struct {
+	Listen         string       `yaml:"listen"`         // E.g., ":8080", the endpoints are not served when unset
+	ReadinessProbe *ProbeConfig `yaml:"readinessProbe"` // Must also pass for shoehorn to be ready
+}
+
+// ProbeConfig represents a check of the managed process. Exactly one of
+// exec, http and tcp must be set.
+type ProbeConfig struct {
+	Exec    []string      `yaml:"exec"`    // Command run without a shell, passes when it exits with 0
+	HTTP    string        `yaml:"http"`    // URL that must respond to GET with a 2xx or 3xx status
+	TCP     string        `yaml:"tcp"`     // Address that must accept connections, e.g. "localhost:5432"
+	Timeout time.Duration `yaml:"timeout"` // Defaults to 1s
+}
+
+// LogConfig represents how shoehorn logs
+type LogConfig struct {
+	Format string `yaml:"format"` // "text" or "json", defaults to text
+	Level  string `yaml:"level"`  // "debug", "info", "warn" or "error", defaults to info
+}
+
+// ControlConfig represents the control socket
+type ControlConfig struct {
+	Socket           string `yaml:"socket"`           // E.g., "/run/shoehorn.sock", the socket is not served when unset
+	RegenerateSignal string `yaml:"regenerateSignal"` // E.g., "SIGUSR1", makes shoehorn regenerate every output and reload
+}
+
+// HooksConfig represents the hooks run on lifecycle events
+type HooksConfig struct {
+	OnGenerate      []HookConfig `yaml:"onGenerate"`      // After an output was generated
+	OnGenerateError []HookConfig `yaml:"onGenerateError"` // After generating an output failed
+	OnReload        []HookConfig `yaml:"onReload"`        // After the managed process was reloaded
+	OnProcessExit   []HookConfig `yaml:"onProcessExit"`   // After the managed process exited
+	OnStart         []HookConfig `yaml:"onStart"`         // After the managed process was started
+}
+
+// HookConfig represents a command or webhook receiving a JSON description of
+// an event. Exactly one of exec and http must be set.
+type HookConfig struct {
+	Exec    []string      `yaml:"exec"`    // Command run without a shell, the event is written to its stdin
+	HTTP    string        `yaml:"http"`    // URL the event is POSTed to
+	Timeout time.Duration `yaml:"timeout"` // Defaults to 10s
+}
+
 func LoadConfig(r io.Reader) (*Config, error) {
-	appConfig := &Config{}
 	configData, err := io.ReadAll(r)
 	if err != nil {
-		log.Fatalf("Failed to read config file: %v", err)
+		return nil, &ErrorReadConfig{Err: err}
 	}
 
-	err = yaml.Unmarshal(configData, appConfig)
+	// Includes of a config without a file are relative to the working directory
+	l := newLoader()
+	err = l.loadData(configData, "config", ".", false)
 	if err != nil {
-		return nil, errors.Join(ErrorParseConfig, err)
+		return nil, err
 	}
 
-	// Validate configuration
-	for _, gen := range appConfig.Generate {
-		if gen.Strategy != "append" && gen.Strategy != "template" {
-			return nil, &ErrorInvalidStrategy{Strategy: gen.Strategy, Name: gen.Name}
-		}
-		if gen.Strategy == "template" && gen.Template == "" {
-			return nil, &ErrorMissingTemplate{Name: gen.Name}
-		}
-	}
-
-	if appConfig.Process.Reload.Enabled {
-		if appConfig.Process.Reload.Method != "restart" && appConfig.Process.Reload.Method != "signal" {
-			return nil, &ErrorInvalidReloadMethod{Method: appConfig.Process.Reload.Method}
-		}
-		if appConfig.Process.Reload.Method == "signal" && appConfig.Process.Reload.Signal == "" {
-			return nil, &ErrorMissingSignal{}
-		}
+	err = l.validate()
+	if err != nil {
+		return nil, err
 	}
-	return appConfig, nil
+	return l.config, nil
 }
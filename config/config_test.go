@@ -1,11 +1,16 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var configTests = []struct {
@@ -106,6 +111,92 @@ process:
 		},
 		expectedError: nil,
 	},
+	{
+		name: "config with output permissions",
+		content: `
+generate:
+  - name: test_file.yml
+    path: /etc/
+    strategy: append
+    mode: 0640
+    dirMode: "0750"
+    owner: app
+    group: "1000"
+    inputs:
+      - name: test.yml
+        path: /sources/
+`,
+		expectedConfig: &Config{
+			Generate: []GenerateConfig{
+				{
+					Name:     "test_file.yml",
+					Path:     "/etc/",
+					Strategy: "append",
+					Mode:     0o640,
+					DirMode:  0o750,
+					Owner:    "app",
+					Group:    "1000",
+					Inputs: []InputFile{
+						{
+							Path: "/sources/",
+							Name: "test.yml",
+						},
+					},
+				},
+			},
+		},
+		expectedError: nil,
+	},
+	{
+		name: "invalid file mode",
+		content: `
+generate:
+  - name: test_file.yml
+    path: /etc/
+    strategy: append
+    mode: rw-r--r--
+    inputs:
+      - name: test.yml
+        path: /sources/
+`,
+		expectedConfig: nil,
+		expectedError:  &ErrorInvalidMode{Value: "rw-r--r--"},
+	},
+	{
+		name: "config with process environment",
+		content: `
+process:
+  path: test_process
+  workingDir: /data
+  umask: "0027"
+  rlimits:
+    nofile: 65535
+    core: unlimited
+`,
+		expectedConfig: &Config{
+			Process: ProcessConfig{
+				Path:       "test_process",
+				WorkingDir: "/data",
+				Umask:      func() *FileMode { m := FileMode(0o027); return &m }(),
+				Rlimits: RlimitsConfig{
+					Nofile: func() *Rlimit { r := Rlimit(65535); return &r }(),
+					Core:   func() *Rlimit { r := RlimitUnlimited; return &r }(),
+				},
+			},
+		},
+		expectedError: nil,
+	},
+	{
+		name: "invalid resource limit",
+		content: `
+process:
+  path: test_process
+  rlimits:
+    nofile: lots
+`,
+		expectedConfig: nil,
+		expectedError:  &ErrorInvalidRlimit{Value: "lots"},
+	},
 	{
 		name: "invalid strategy",
 		content: `
@@ -138,6 +229,7 @@ generate:
     strategy: template
     inputs:
       - name: test.yml
+        path: /sources/
 
 process:
   path: test_process
@@ -149,7 +241,7 @@ process:
     - arg2
 `,
 		expectedConfig: nil,
-		expectedError:  &ErrorInvalidStrategy{Strategy: "non_existent_strategy", Name: "test_file.yml"},
+		expectedError:  &ErrorMissingTemplate{Name: "test_file.yml"},
 	},
 	{
 		name: "invalid reload method",
@@ -158,9 +250,10 @@ generate:
   - name: test_file.yml
     path: /etc/
     strategy: template
+    template: /templates/test.tmpl
     inputs:
       - name: test.yml
-      	path: /sources/
+        path: /sources/
 
 process:
   path: test_process
@@ -181,9 +274,10 @@ generate:
   - name: test_file.yml
     path: /etc/
     strategy: template
+    template: /templates/test.tmpl
     inputs:
       - name: test.yml
-      	path: /sources/
+        path: /sources/
 
 process:
   path: test_process
@@ -197,6 +291,116 @@ process:
 		expectedConfig: nil,
 		expectedError:  &ErrorMissingSignal{},
 	},
+	{
+		name: "invalid watch mode",
+		content: `
+generate:
+  - name: test_file.yml
+    path: /etc/
+    strategy: append
+    inputs:
+      - path: test.yml
+watch:
+  mode: fanotify
+  pollInterval: 5s
+`,
+		expectedConfig: nil,
+		expectedError:  &ErrorInvalidWatchMode{Mode: "fanotify"},
+	},
+	{
+		name: "readiness probe with several checks",
+		content: `
+generate:
+  - name: test_file.yml
+    path: /etc/
+    strategy: append
+    inputs:
+      - path: test.yml
+health:
+  listen: ":8080"
+  readinessProbe:
+    http: http://localhost:8000/ready
+    tcp: localhost:8000
+`,
+		expectedConfig: nil,
+		expectedError:  &ErrorInvalidProbe{Kinds: 2},
+	},
+	{
+		name: "hook without exec or http",
+		content: `
+generate:
+  - name: test_file.yml
+    path: /etc/
+    strategy: append
+    inputs:
+      - path: test.yml
+hooks:
+  onGenerate:
+    - timeout: 5s
+`,
+		expectedConfig: nil,
+		expectedError:  &ErrorInvalidHook{Kinds: 0},
+	},
+	{
+		name: "invalid regenerate signal",
+		content: `
+generate:
+  - name: test_file.yml
+    path: /etc/
+    strategy: append
+    inputs:
+      - path: test.yml
+control:
+  regenerateSignal: SIGTERM
+`,
+		expectedConfig: nil,
+		expectedError:  &ErrorInvalidRegenerateSignal{Signal: "SIGTERM"},
+	},
+	{
+		name: "input with both path and env",
+		content: `
+generate:
+  - name: test_file.yml
+    path: /etc/
+    strategy: append
+    inputs:
+      - path: test.yml
+        env: TEST
+`,
+		expectedConfig: nil,
+		expectedError:  &ErrorConflictingInput{Path: "test.yml", Env: "TEST"},
+	},
+	{
+		name: "invalid health check action",
+		content: `
+generate:
+  - name: test_file.yml
+    path: /etc/
+    strategy: append
+    inputs:
+      - path: test.yml
+process:
+  path: test_process
+  healthCheck:
+    exec: [test_process, --check]
+    interval: 30s
+    onFailure: ignore
+`,
+		expectedConfig: nil,
+		expectedError:  &ErrorInvalidOnFailure{OnFailure: "ignore"},
+	},
+	{
+		name: "invalid process output format",
+		content: `
+process:
+  path: test_process
+  output:
+    format: syslog
+    file: /var/log/test_process.log
+`,
+		expectedConfig: nil,
+		expectedError:  &ErrorInvalidOutputFormat{Format: "syslog"},
+	},
 }
 
 func TestLoadConfig(t *testing.T) {
@@ -205,8 +409,10 @@ func TestLoadConfig(t *testing.T) {
 			r := strings.NewReader(tc.content)
 			appConfig, err := LoadConfig(r)
 			if tc.expectedError != nil {
-				fmt.Println("Expected error:", tc.expectedError)
-				assert.ErrorAs(t, err, &tc.expectedError, "Expected error: %v, got: %v", tc.expectedError, err)
+				target := reflect.New(reflect.TypeOf(tc.expectedError))
+				if assert.ErrorAs(t, err, target.Interface(), "Expected error: %v, got: %v", tc.expectedError, err) {
+					assert.Equal(t, tc.expectedError, target.Elem().Interface())
+				}
 			} else {
 				assert.NoError(t, err, "Expected no error, got: %v", err)
 			}
@@ -214,3 +420,505 @@ func TestLoadConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{
+		"DATA_DIR": "/data",
+		"EMPTY":    "",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	tests := []struct {
+		name          string
+		value         string
+		expected      string
+		expectedError error
+	}{
+		{"no references", "/etc/app.conf", "/etc/app.conf", nil},
+		{"plain reference", "${DATA_DIR}/app.conf", "/data/app.conf", nil},
+		{"multiple references", "${DATA_DIR}:${DATA_DIR}", "/data:/data", nil},
+		{"unset reference", "/etc/${MISSING}app.conf", "/etc/app.conf", nil},
+		{"default for unset", "${MISSING:-/tmp}/app.conf", "/tmp/app.conf", nil},
+		{"default for empty", "${EMPTY:-/tmp}/app.conf", "/tmp/app.conf", nil},
+		{"default unused", "${DATA_DIR:-/tmp}/app.conf", "/data/app.conf", nil},
+		{"required and set", "${DATA_DIR:?data dir is required}", "/data", nil},
+		{"required and unset", "${MISSING:?data dir is required}", "", &ErrorUnsetVariable{Name: "MISSING", Message: "data dir is required"}},
+		{"required and empty", "${EMPTY:?}", "", &ErrorUnsetVariable{Name: "EMPTY"}},
+		{"escaped reference", "$${DATA_DIR}", "${DATA_DIR}", nil},
+		{"shell variables untouched", "echo $1 $HOME", "echo $1 $HOME", nil},
+		{"unterminated reference", "${DATA_DIR", "", &ErrorInvalidExpansion{Value: "${DATA_DIR"}},
+		{"unknown operator", "${DATA_DIR:+set}", "", &ErrorInvalidExpansion{Value: "${DATA_DIR:+set}"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			expanded, err := ExpandEnv(tc.value, lookup)
+			if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expected, expanded)
+		})
+	}
+}
+
+func TestLoadConfigExpandsEnv(t *testing.T) {
+	t.Setenv("SHOEHORN_TEST_DIR", "/data")
+	t.Setenv("SHOEHORN_TEST_SIGNAL", "SIGUSR1")
+
+	content := `
+generate:
+  - name: ${SHOEHORN_TEST_NAME:-app.conf}
+    path: ${SHOEHORN_TEST_DIR}/conf
+    strategy: append
+    inputs:
+      - name: main
+        path: ${SHOEHORN_TEST_DIR}/main.conf
+
+process:
+  path: /bin/app
+  reload:
+    enabled: true
+    method: signal
+    signal: ${SHOEHORN_TEST_SIGNAL}
+  args:
+    - --data=${SHOEHORN_TEST_DIR}
+`
+	appConfig, err := LoadConfig(strings.NewReader(content))
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{
+		Generate: []GenerateConfig{
+			{
+				Name:     "app.conf",
+				Path:     "/data/conf",
+				Strategy: "append",
+				Inputs: []InputFile{
+					{Name: "main", Path: "/data/main.conf"},
+				},
+			},
+		},
+		Process: ProcessConfig{
+			Path: "/bin/app",
+			Reload: ReloadConfig{
+				Enabled: true,
+				Method:  "signal",
+				Signal:  "SIGUSR1",
+			},
+			Args: []string{"--data=/data"},
+		},
+	}, appConfig)
+
+	_, err = LoadConfig(strings.NewReader("process:\n  path: ${SHOEHORN_TEST_UNSET:?process path is required}\n"))
+	assert.Equal(t, ValidationErrors{{
+		Source: "config",
+		Line:   2,
+		Path:   "process.path",
+		Err:    &ErrorUnsetVariable{Name: "SHOEHORN_TEST_UNSET", Message: "process path is required"},
+	}}, err)
+}
+
+// writeFragments writes each fragment beneath dir and returns dir
+func writeFragments(t *testing.T, fragments map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range fragments {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return dir
+}
+
+func TestLoadConfigFileWithIncludes(t *testing.T) {
+	dir := writeFragments(t, map[string]string{
+		"shoehorn.yaml": `
+include:
+  - shoehorn.d/*.yaml
+generate:
+  - name: base.conf
+    path: /etc/app
+    strategy: append
+process:
+  path: /bin/app
+`,
+		"shoehorn.d/10-extra.yaml": `
+generate:
+  - name: extra.conf
+    path: /etc/app
+    strategy: append
+`,
+		"shoehorn.d/20-more.yaml": `
+generate:
+  - name: more.conf
+    path: /etc/app
+    strategy: append
+`,
+	})
+
+	appConfig, err := LoadConfigFile(filepath.Join(dir, "shoehorn.yaml"))
+	require.NoError(t, err)
+
+	var names []string
+	for _, gen := range appConfig.Generate {
+		names = append(names, gen.Name)
+	}
+	assert.Equal(t, []string{"base.conf", "extra.conf", "more.conf"}, names)
+	assert.Equal(t, "/bin/app", appConfig.Process.Path)
+}
+
+func TestLoadConfigFileResolvesIncludedPaths(t *testing.T) {
+	dir := writeFragments(t, map[string]string{
+		"shoehorn.yaml": `
+include:
+  - shoehorn.d/app.yaml
+generate:
+  - name: base.conf
+    path: out
+    strategy: append
+    inputs:
+      - path: base.txt
+`,
+		"shoehorn.d/app.yaml": `
+generate:
+  - name: app.conf
+    path: out
+    strategy: template
+    template: app.tmpl
+    inputs:
+      - name: settings
+        path: inputs/*.txt
+      - name: shared
+        path: /abs/input.txt
+      - name: token
+        env: TOKEN
+process:
+  path: bin/app
+  workingDir: work
+`,
+	})
+
+	appConfig, err := LoadConfigFile(filepath.Join(dir, "shoehorn.yaml"))
+	require.NoError(t, err)
+	require.Len(t, appConfig.Generate, 2)
+
+	// The config given to shoehorn stays relative to the working directory
+	base := appConfig.Generate[0]
+	assert.Equal(t, "out", base.Path)
+	assert.Equal(t, "base.txt", base.Inputs[0].Path)
+
+	// An included fragment is relative to its own directory
+	fragmentDir := filepath.Join(dir, "shoehorn.d")
+	app := appConfig.Generate[1]
+	assert.Equal(t, filepath.Join(fragmentDir, "out"), app.Path)
+	assert.Equal(t, filepath.Join(fragmentDir, "app.tmpl"), app.Template)
+	assert.Equal(t, filepath.Join(fragmentDir, "inputs/*.txt"), app.Inputs[0].Path)
+	assert.Equal(t, "/abs/input.txt", app.Inputs[1].Path)
+	assert.Empty(t, app.Inputs[2].Path)
+	assert.Equal(t, filepath.Join(fragmentDir, "work"), appConfig.Process.WorkingDir)
+	// The process may be looked up in PATH or the working directory
+	assert.Equal(t, "bin/app", appConfig.Process.Path)
+}
+
+func TestLoadConfigFileDirectory(t *testing.T) {
+	dir := writeFragments(t, map[string]string{
+		"00-process.yaml": `
+process:
+  path: /bin/app
+`,
+		"10-app.yml": `
+generate:
+  - name: app.conf
+    path: /etc/app
+    strategy: append
+`,
+		"README.md": "not a config fragment",
+		// E.g. left behind by an editor
+		".10-app.yml.swp.yml": "generate: [",
+	})
+
+	appConfig, err := LoadConfigFile(dir)
+	require.NoError(t, err)
+	require.Len(t, appConfig.Generate, 1)
+	assert.Equal(t, "app.conf", appConfig.Generate[0].Name)
+	assert.Equal(t, "/bin/app", appConfig.Process.Path)
+}
+
+func TestLoadConfigFileConflicts(t *testing.T) {
+	dir := writeFragments(t, map[string]string{
+		"a.yaml": `
+generate:
+  - name: app.conf
+    path: /etc/app
+    strategy: append
+process:
+  path: /bin/app
+`,
+		"b.yaml": `
+generate:
+  - name: app.conf
+    path: /etc/app/
+    strategy: template
+    template: /templates/app.tmpl
+`,
+		"c.yaml": `
+process:
+  path: /bin/other
+`,
+		"d.yaml": `
+watch:
+  pollInterval: 10s
+`,
+		"e.yaml": `
+process:
+  path: /bin/other
+watch:
+  pollInterval: 10s
+`,
+		"missing.yaml": `
+include:
+  - does-not-exist.yaml
+`,
+	})
+
+	_, err := LoadConfigFile(filepath.Join(dir, "a.yaml"))
+	require.NoError(t, err)
+
+	_, err = LoadConfig(strings.NewReader("include: [" + filepath.Join(dir, "a.yaml") + ", " + filepath.Join(dir, "b.yaml") + "]"))
+	var conflictingOutput *ErrorConflictingOutput
+	require.ErrorAs(t, err, &conflictingOutput)
+	assert.Equal(t, &ErrorConflictingOutput{
+		Path:    "/etc/app/app.conf",
+		Sources: []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")},
+	}, conflictingOutput)
+
+	_, err = LoadConfig(strings.NewReader("include: [" + filepath.Join(dir, "a.yaml") + ", " + filepath.Join(dir, "c.yaml") + "]"))
+	var conflictingProcess *ErrorConflictingProcess
+	require.ErrorAs(t, err, &conflictingProcess)
+	assert.Equal(t, &ErrorConflictingProcess{
+		Sources: []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "c.yaml")},
+	}, conflictingProcess)
+
+	_, err = LoadConfig(strings.NewReader("include: [" + filepath.Join(dir, "a.yaml") + ", " + filepath.Join(dir, "d.yaml") + "]\nwatch:\n  mode: poll\n"))
+	var conflictingSection *ErrorConflictingSection
+	require.ErrorAs(t, err, &conflictingSection)
+	assert.Equal(t, &ErrorConflictingSection{
+		Section: "watch",
+		Sources: []string{"config", filepath.Join(dir, "d.yaml")},
+	}, conflictingSection)
+
+	// A conflicting process does not hide conflicts of the other sections
+	_, err = LoadConfig(strings.NewReader("include: [" + filepath.Join(dir, "a.yaml") + ", " + filepath.Join(dir, "e.yaml") + "]\nwatch:\n  mode: poll\n"))
+	require.ErrorAs(t, err, &conflictingProcess)
+	require.ErrorAs(t, err, &conflictingSection)
+	assert.Equal(t, &ErrorConflictingSection{
+		Section: "watch",
+		Sources: []string{"config", filepath.Join(dir, "e.yaml")},
+	}, conflictingSection)
+
+	_, err = LoadConfigFile(filepath.Join(dir, "missing.yaml"))
+	assert.Equal(t, &ErrorIncludeNotFound{
+		Path:   filepath.Join(dir, "does-not-exist.yaml"),
+		Source: filepath.Join(dir, "missing.yaml"),
+	}, err)
+}
+
+func TestLoadConfigCollectsValidationErrors(t *testing.T) {
+	content := `generate:
+  - name: app.conf
+    path: /etc/app
+    stratgy: append
+    inputs:
+      - name: main
+        path: /etc/app/main.conf
+      - name: main
+        path: /etc/app/app.conf
+  - path: /etc/app
+    strategy: template
+    template: /templates/app.tmpl
+    inputs:
+      - path: /secrets/password
+process:
+  reload:
+    enabled: true
+    method: signal
+`
+	_, err := LoadConfig(strings.NewReader(content))
+
+	var validationErrs ValidationErrors
+	require.ErrorAs(t, err, &validationErrs)
+
+	var found []string
+	for _, validationErr := range validationErrs {
+		found = append(found, fmt.Sprintf("%d %s %T", validationErr.Line, validationErr.Path, validationErr.Err))
+	}
+	assert.ElementsMatch(t, []string{
+		"4 generate[0].stratgy *config.ErrorUnknownField",
+		"2 generate[0].strategy *config.ErrorInvalidStrategy",
+		"8 generate[0].inputs[1].name *config.ErrorDuplicateInput",
+		"2 generate[0] *config.ErrorOutputCycle",
+		"10 generate[1].name *config.ErrorMissingField",
+		"14 generate[1].inputs[0].name *config.ErrorMissingField",
+		"15 process.path *config.ErrorMissingField",
+		"16 process.reload.signal *config.ErrorMissingSignal",
+	}, found)
+
+	// Typed errors can still be matched through the collected errors
+	var missingSignal *ErrorMissingSignal
+	assert.ErrorAs(t, err, &missingSignal)
+	assert.Contains(t, err.Error(), "config:4: generate[0].stratgy: unknown field 'stratgy'")
+}
+
+func TestLoadConfigCollectsDecodeErrors(t *testing.T) {
+	content := `generate:
+  - name: app.conf
+    path: /etc/app
+    strategy: append
+    mode: rw-r--r--
+    inputs: 5
+process:
+  path: ${SHOEHORN_TEST_UNSET:?process path is required}
+  rlimits:
+    nofile: lots
+watch:
+  pollInterval: often
+  mode: fanotify
+`
+	_, err := LoadConfig(strings.NewReader(content))
+
+	var validationErrs ValidationErrors
+	require.ErrorAs(t, err, &validationErrs)
+
+	var found []string
+	for _, validationErr := range validationErrs {
+		found = append(found, fmt.Sprintf("%d %s %T", validationErr.Line, validationErr.Path, validationErr.Err))
+	}
+	assert.ElementsMatch(t, []string{
+		"5 generate[0].mode *config.ErrorInvalidMode",
+		"6 generate[0].inputs *errors.errorString",
+		"8 process.path *config.ErrorUnsetVariable",
+		"10 process.rlimits.nofile *config.ErrorInvalidRlimit",
+		"12 watch.pollInterval *time.parseDurationError",
+		"13 watch.mode *config.ErrorInvalidWatchMode",
+	}, found)
+}
+
+func TestLoadConfigDetectsIndirectCycles(t *testing.T) {
+	content := `
+generate:
+  - name: a.conf
+    path: /etc/app
+    strategy: append
+    inputs:
+      - path: /etc/app/b.conf
+  - name: b.conf
+    path: /etc/app
+    strategy: append
+    inputs:
+      - path: /etc/app/a.conf
+  - name: c.conf
+    path: /etc/app
+    strategy: append
+    inputs:
+      - path: /etc/app/a.conf
+`
+	_, err := LoadConfig(strings.NewReader(content))
+
+	var cycle *ErrorOutputCycle
+	require.ErrorAs(t, err, &cycle)
+	assert.Equal(t, &ErrorOutputCycle{Output: "/etc/app/b.conf", Name: "a.conf"}, cycle)
+
+	// Chaining outputs without a cycle is allowed
+	chained := `
+generate:
+  - name: a.conf
+    path: /etc/app
+    strategy: append
+    inputs:
+      - path: /etc/app/base.conf
+  - name: b.conf
+    path: /etc/app
+    strategy: append
+    inputs:
+      - path: /etc/app/a.conf
+`
+	_, err = LoadConfig(strings.NewReader(chained))
+	assert.NoError(t, err)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestLoadConfigReadErrors(t *testing.T) {
+	_, err := LoadConfig(failingReader{})
+	var readErr *ErrorReadConfig
+	assert.ErrorAs(t, err, &readErr)
+
+	_, err = LoadConfigFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorAs(t, err, &readErr)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestSchemaDescribesEveryField(t *testing.T) {
+	// Walk every struct reachable from Config and check the schema knows it
+	seen := make(map[reflect.Type]bool)
+	var walk func(reflect.Type, *JSONSchema)
+	walk = func(typ reflect.Type, schema *JSONSchema) {
+		for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice {
+			typ = typ.Elem()
+			if schema.Items != nil {
+				schema = schema.Items
+			}
+		}
+		if typ.Kind() != reflect.Struct || seen[typ] {
+			return
+		}
+		seen[typ] = true
+
+		// Fields of inline structs are properties of the embedding struct
+		var fields []reflect.StructField
+		var collect func(reflect.Type)
+		collect = func(typ reflect.Type) {
+			for i := 0; i < typ.NumField(); i++ {
+				field := typ.Field(i)
+				if isInline(field) {
+					seen[field.Type] = true
+					collect(field.Type)
+				} else if field.IsExported() {
+					fields = append(fields, field)
+				}
+			}
+		}
+		collect(typ)
+
+		for _, field := range fields {
+			key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			name := typ.Name() + "." + field.Name
+
+			property, ok := schema.Properties[key]
+			if !assert.True(t, ok, "schema is missing %s", name) {
+				continue
+			}
+			assert.NotEmpty(t, property.Description, "schema is missing a description for %s", name)
+			walk(field.Type, property)
+		}
+		assert.Len(t, schema.Properties, len(fields), "schema of %s has unknown properties", typ.Name())
+	}
+	walk(reflect.TypeOf(Config{}), Schema())
+
+	for name := range schemaDescriptions {
+		typeName, fieldName, _ := strings.Cut(name, ".")
+		found := false
+		for typ := range seen {
+			if _, ok := typ.FieldByName(fieldName); ok && typ.Name() == typeName {
+				found = true
+			}
+		}
+		assert.True(t, found, "schema describes %s which does not exist", name)
+	}
+}
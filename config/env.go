@@ -0,0 +1,105 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// ExpandEnv replaces ${VAR}, ${VAR:-default} and ${VAR:?message} references
+// in s with values returned by lookup. A default is used when the variable is
+// unset or empty, while ${VAR:?message} fails in that case. $${ produces a
+// literal ${.
+func ExpandEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	var sb strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start == -1 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+
+		// An escaped reference is kept as is, without its leading $
+		if start > 0 && s[start-1] == '$' {
+			sb.WriteString(s[:start-1])
+			sb.WriteString("${")
+			s = s[start+2:]
+			continue
+		}
+
+		end := strings.IndexByte(s[start:], '}')
+		if end == -1 {
+			return "", &ErrorInvalidExpansion{Value: s[start:]}
+		}
+		end += start
+
+		value, err := expandReference(s[start+2:end], lookup)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(s[:start])
+		sb.WriteString(value)
+		s = s[end+1:]
+	}
+}
+
+func expandReference(ref string, lookup func(string) (string, bool)) (string, error) {
+	name, operand, op := ref, "", ""
+	if i := strings.Index(ref, ":"); i != -1 {
+		name, op, operand = ref[:i], ref[i:min(i+2, len(ref))], ref[min(i+2, len(ref)):]
+	}
+	if name == "" || (op != "" && op != ":-" && op != ":?") {
+		return "", &ErrorInvalidExpansion{Value: "${" + ref + "}"}
+	}
+
+	value, ok := lookup(name)
+	if ok && value != "" {
+		return value, nil
+	}
+
+	switch op {
+	case ":-":
+		return operand, nil
+	case ":?":
+		return "", &ErrorUnsetVariable{Name: name, Message: operand}
+	}
+	return value, nil
+}
+
+// expandConfig expands environment variable references in every string field
+// of appConfig, reporting every reference that fails at the field located by o
+func expandConfig(appConfig *Config, o origin, lookup func(string) (string, bool)) []*ValidationError {
+	return expandValue(reflect.ValueOf(appConfig).Elem(), o, lookup)
+}
+
+func expandValue(v reflect.Value, o origin, lookup func(string) (string, bool)) []*ValidationError {
+	var errs []*ValidationError
+	switch v.Kind() {
+	case reflect.String:
+		expanded, err := ExpandEnv(v.String(), lookup)
+		if err != nil {
+			return []*ValidationError{o.error(err)}
+		}
+		v.SetString(expanded)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fieldOrigin := o
+			if !isInline(field) {
+				fieldOrigin = o.child(".%s", strings.Split(field.Tag.Get("yaml"), ",")[0])
+			}
+			errs = append(errs, expandValue(v.Field(i), fieldOrigin, lookup)...)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, expandValue(v.Index(i), o.child("[%d]", i), lookup)...)
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return expandValue(v.Elem(), o, lookup)
+		}
+	}
+	return errs
+}
@@ -3,10 +3,24 @@ package config
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var ErrorParseConfig = errors.New("failed to parse config")
 
+// ErrorReadConfig is returned when a config cannot be read
+type ErrorReadConfig struct {
+	Err error
+}
+
+func (e *ErrorReadConfig) Error() string {
+	return fmt.Sprintf("failed to read config: %v", e.Err)
+}
+
+func (e *ErrorReadConfig) Unwrap() error {
+	return e.Err
+}
+
 // ErrorInvalidStrategy is returned when an invalid strategy is specified
 type ErrorInvalidStrategy struct {
 	Strategy string
@@ -14,7 +28,7 @@ type ErrorInvalidStrategy struct {
 }
 
 func (e *ErrorInvalidStrategy) Error() string {
-	return fmt.Sprintf("invalid strategy '%s' for config '%s'. Must be 'append' or 'template'", e.Strategy, e.Name)
+	return fmt.Sprintf("invalid strategy '%s' for config '%s'. Must be 'append', 'template' or 'directory'", e.Strategy, e.Name)
 }
 
 // ErrorMissingTemplate is returned when a template path is required but not provided
@@ -23,7 +37,7 @@ type ErrorMissingTemplate struct {
 }
 
 func (e *ErrorMissingTemplate) Error() string {
-	return fmt.Sprintf("template path must be provided when strategy is 'template' for '%s'", e.Name)
+	return fmt.Sprintf("template path must be provided when strategy is 'template' or 'directory' for '%s'", e.Name)
 }
 
 // ErrorInvalidReloadMethod is returned when an invalid reload method is specified
@@ -41,3 +55,215 @@ type ErrorMissingSignal struct{}
 func (e *ErrorMissingSignal) Error() string {
 	return "signal must be provided when reload method is 'signal'"
 }
+
+// ErrorInvalidRegenerateSignal is returned when an invalid signal is specified
+// to trigger regeneration
+type ErrorInvalidRegenerateSignal struct {
+	Signal string
+}
+
+func (e *ErrorInvalidRegenerateSignal) Error() string {
+	return fmt.Sprintf("invalid regenerate signal '%s'. Must be 'SIGHUP', 'SIGUSR1' or 'SIGUSR2'", e.Signal)
+}
+
+// ErrorConflictingInput is returned when an input sets both a path and an
+// environment variable
+type ErrorConflictingInput struct {
+	Path string
+	Env  string
+}
+
+func (e *ErrorConflictingInput) Error() string {
+	return fmt.Sprintf("input must set either path '%s' or env '%s', not both", e.Path, e.Env)
+}
+
+// ErrorInvalidMode is returned when a file mode is not a valid octal permission
+type ErrorInvalidMode struct {
+	Value string
+}
+
+func (e *ErrorInvalidMode) Error() string {
+	return fmt.Sprintf("invalid file mode '%s'. Must be an octal permission such as '0640'", e.Value)
+}
+
+// ErrorInvalidRlimit is returned when a resource limit is not a number or "unlimited"
+type ErrorInvalidRlimit struct {
+	Value string
+}
+
+func (e *ErrorInvalidRlimit) Error() string {
+	return fmt.Sprintf("invalid resource limit '%s'. Must be a positive number or 'unlimited'", e.Value)
+}
+
+// ErrorUnsetVariable is returned when a ${VAR:?message} reference names a variable that is unset or empty
+type ErrorUnsetVariable struct {
+	Name    string
+	Message string
+}
+
+func (e *ErrorUnsetVariable) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("environment variable '%s' must be set", e.Name)
+	}
+	return fmt.Sprintf("environment variable '%s' must be set: %s", e.Name, e.Message)
+}
+
+// ErrorInvalidExpansion is returned when an environment variable reference is malformed
+type ErrorInvalidExpansion struct {
+	Value string
+}
+
+func (e *ErrorInvalidExpansion) Error() string {
+	return fmt.Sprintf("invalid environment variable reference '%s'. Must be ${VAR}, ${VAR:-default} or ${VAR:?message}", e.Value)
+}
+
+// ErrorConflictingOutput is returned when more than one config fragment generates the same output path
+type ErrorConflictingOutput struct {
+	Path    string
+	Sources []string
+}
+
+func (e *ErrorConflictingOutput) Error() string {
+	return fmt.Sprintf("output '%s' is generated by more than one config: %s", e.Path, strings.Join(e.Sources, ", "))
+}
+
+// ErrorConflictingProcess is returned when more than one config fragment defines the managed process
+type ErrorConflictingProcess struct {
+	Sources []string
+}
+
+func (e *ErrorConflictingProcess) Error() string {
+	return fmt.Sprintf("process is defined by more than one config: %s", strings.Join(e.Sources, ", "))
+}
+
+// ErrorConflictingSection is returned when more than one config fragment
+// sets the same top-level section, e.g. watch
+type ErrorConflictingSection struct {
+	Section string
+	Sources []string
+}
+
+func (e *ErrorConflictingSection) Error() string {
+	return fmt.Sprintf("%s is defined by more than one config: %s", e.Section, strings.Join(e.Sources, ", "))
+}
+
+// ErrorIncludeNotFound is returned when an included config path does not exist
+type ErrorIncludeNotFound struct {
+	Path   string
+	Source string
+}
+
+func (e *ErrorIncludeNotFound) Error() string {
+	return fmt.Sprintf("included config '%s' in '%s' does not exist", e.Path, e.Source)
+}
+
+// ErrorUnknownField is returned when a config contains a key that shoehorn does not know
+type ErrorUnknownField struct {
+	Field string
+}
+
+func (e *ErrorUnknownField) Error() string {
+	return fmt.Sprintf("unknown field '%s'", e.Field)
+}
+
+// ErrorMissingField is returned when a required field is empty or not provided
+type ErrorMissingField struct {
+	Field string
+}
+
+func (e *ErrorMissingField) Error() string {
+	return fmt.Sprintf("'%s' must be provided", e.Field)
+}
+
+// ErrorDuplicateInput is returned when two inputs of the same output share a name
+type ErrorDuplicateInput struct {
+	Name   string
+	Output string
+}
+
+func (e *ErrorDuplicateInput) Error() string {
+	return fmt.Sprintf("input name '%s' is used more than once for '%s'", e.Name, e.Output)
+}
+
+// ErrorOutputCycle is returned when an output is, directly or through other outputs, an input of itself
+type ErrorOutputCycle struct {
+	Output string
+	Name   string
+}
+
+func (e *ErrorOutputCycle) Error() string {
+	return fmt.Sprintf("output '%s' feeds back into '%s', forming a cycle", e.Output, e.Name)
+}
+
+// ErrorInvalidWatchMode is returned when an invalid watch mode is specified
+type ErrorInvalidWatchMode struct {
+	Mode string
+}
+
+func (e *ErrorInvalidWatchMode) Error() string {
+	return fmt.Sprintf("invalid watch mode '%s'. Must be 'inotify', 'poll' or 'auto'", e.Mode)
+}
+
+// ErrorNegativeValue is returned when a duration or count is negative
+type ErrorNegativeValue struct {
+	Field string
+}
+
+func (e *ErrorNegativeValue) Error() string {
+	return fmt.Sprintf("%s must not be negative", e.Field)
+}
+
+// ErrorInvalidProbe is returned when a probe does not set exactly one check
+type ErrorInvalidProbe struct {
+	Kinds int // Number of checks set
+}
+
+func (e *ErrorInvalidProbe) Error() string {
+	return fmt.Sprintf("probe must set exactly one of exec, http and tcp, got %d", e.Kinds)
+}
+
+// ErrorInvalidHook is returned when a hook does not set exactly one of exec
+// and http
+type ErrorInvalidHook struct {
+	Kinds int // Number of kinds set
+}
+
+func (e *ErrorInvalidHook) Error() string {
+	return fmt.Sprintf("hook must set exactly one of exec and http, got %d", e.Kinds)
+}
+
+// ErrorInvalidOnFailure is returned when an invalid health check action is specified
+type ErrorInvalidOnFailure struct {
+	OnFailure string
+}
+
+func (e *ErrorInvalidOnFailure) Error() string {
+	return fmt.Sprintf("invalid health check onFailure '%s'. Must be 'restart' or 'unready'", e.OnFailure)
+}
+
+// ErrorInvalidLogFormat is returned when an invalid log format is specified
+type ErrorInvalidLogFormat struct {
+	Format string
+}
+
+func (e *ErrorInvalidLogFormat) Error() string {
+	return fmt.Sprintf("invalid log format '%s'. Must be 'text' or 'json'", e.Format)
+}
+
+// ErrorInvalidLogLevel is returned when an invalid log level is specified
+type ErrorInvalidLogLevel struct {
+	Level string
+}
+
+func (e *ErrorInvalidLogLevel) Error() string {
+	return fmt.Sprintf("invalid log level '%s'. Must be 'debug', 'info', 'warn' or 'error'", e.Level)
+}
+
+// ErrorInvalidOutputFormat is returned when an invalid process output format is specified
+type ErrorInvalidOutputFormat struct {
+	Format string
+}
+
+func (e *ErrorInvalidOutputFormat) Error() string {
+	return fmt.Sprintf("invalid process output format '%s'. Must be 'passthrough', 'prefix' or 'json'", e.Format)
+}
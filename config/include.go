@@ -0,0 +1,254 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// LoadConfigFile loads the config at path, merging any fragments it includes.
+// If path is a directory, every *.yaml and *.yml file in it is loaded in
+// lexical order and merged into one config.
+func LoadConfigFile(path string) (*Config, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, &ErrorReadConfig{Err: err}
+	}
+
+	l := newLoader()
+	if info.IsDir() {
+		err = l.loadDir(path, false)
+	} else {
+		err = l.loadFile(path, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.validate()
+	if err != nil {
+		return nil, err
+	}
+	return l.config, nil
+}
+
+// loader merges config fragments, remembering where each output and the
+// process were defined to report conflicts and validation errors
+type loader struct {
+	config          *Config
+	loaded          map[string]bool
+	outputSources   map[string]string
+	generateOrigins []origin // Parallel to config.Generate
+	processOrigin   origin
+	sectionOrigins  map[string]origin // Other top-level sections, keyed by YAML key
+	errs            ValidationErrors
+}
+
+func newLoader() *loader {
+	return &loader{
+		config:         &Config{},
+		loaded:         make(map[string]bool),
+		outputSources:  make(map[string]string),
+		sectionOrigins: make(map[string]origin),
+	}
+}
+
+// loadDir merges every fragment in dir. Relative paths in the fragments are
+// resolved against dir when it was included.
+func (l *loader) loadDir(dir string, included bool) error {
+	l.config.sources = append(l.config.sources, dir)
+
+	var fragments []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		pattern = filepath.Join(dir, pattern)
+		l.config.sourcePatterns = append(l.config.sourcePatterns, pattern)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		for _, match := range matches {
+			// Hidden files are not fragments, e.g. editor swap and lock files
+			if !strings.HasPrefix(filepath.Base(match), ".") {
+				fragments = append(fragments, match)
+			}
+		}
+	}
+	sort.Strings(fragments)
+
+	for _, fragment := range fragments {
+		err := l.loadFile(fragment, included)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadFile merges the fragment at path. Relative paths in the fragment are
+// resolved against its directory when it was included.
+func (l *loader) loadFile(path string, included bool) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	// A fragment matched by more than one include, or including itself, is
+	// only merged once
+	if l.loaded[absPath] {
+		return nil
+	}
+	l.loaded[absPath] = true
+	l.config.sources = append(l.config.sources, path)
+
+	configData, err := os.ReadFile(path)
+	if err != nil {
+		return &ErrorReadConfig{Err: err}
+	}
+	return l.loadData(configData, path, filepath.Dir(path), included)
+}
+
+// loadData merges a fragment and then the fragments it includes, resolving
+// relative includes against baseDir. The other relative paths of an included
+// fragment are resolved against baseDir as well, so it behaves the same
+// wherever shoehorn is started, while those of the config given to shoehorn
+// stay relative to the working directory.
+func (l *loader) loadData(configData []byte, source, baseDir string, included bool) error {
+	file, err := parser.ParseBytes(configData, 0)
+	if err != nil {
+		return errors.Join(ErrorParseConfig, err)
+	}
+
+	// Record line numbers and unknown fields before decoding, which would
+	// otherwise silently ignore them
+	frag := &fragment{name: source, lines: make(map[string]int)}
+	for _, doc := range file.Docs {
+		if doc.Body != nil {
+			l.errs = append(l.errs, frag.walkFields(doc.Body, reflect.TypeOf(Config{}), "")...)
+		}
+	}
+
+	// Values that cannot be decoded or expanded are reported with the other
+	// problems of the config, the rest of the fragment is still merged
+	fragmentConfig := &Config{}
+	if len(file.Docs) > 0 && file.Docs[0].Body != nil {
+		dec := yaml.NewDecoder(bytes.NewReader(nil))
+		l.errs = append(l.errs, frag.decodeNode(dec, file.Docs[0].Body, reflect.ValueOf(fragmentConfig).Elem(), "")...)
+	}
+	l.errs = append(l.errs, expandConfig(fragmentConfig, origin{fragment: frag}, os.LookupEnv)...)
+	if included {
+		resolvePaths(fragmentConfig, baseDir)
+	}
+	l.merge(fragmentConfig, frag)
+
+	for _, pattern := range fragmentConfig.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(baseDir, pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		// A glob may match nothing, but a plain path must exist
+		if strings.ContainsAny(pattern, "*?[") {
+			l.config.sourcePatterns = append(l.config.sourcePatterns, pattern)
+		} else if len(matches) == 0 {
+			return &ErrorIncludeNotFound{Path: pattern, Source: source}
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return &ErrorReadConfig{Err: err}
+			}
+			if info.IsDir() {
+				err = l.loadDir(match, true)
+			} else {
+				err = l.loadFile(match, true)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolvePaths makes the relative file paths of fragmentConfig relative to
+// baseDir. The process path is left alone, as it may be looked up in PATH.
+func resolvePaths(fragmentConfig *Config, baseDir string) {
+	resolve := func(path *string) {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(baseDir, *path)
+		}
+	}
+
+	for i := range fragmentConfig.Generate {
+		gen := &fragmentConfig.Generate[i]
+		resolve(&gen.Path)
+		resolve(&gen.Template)
+		for j := range gen.Inputs {
+			resolve(&gen.Inputs[j].Path)
+		}
+	}
+	resolve(&fragmentConfig.Process.WorkingDir)
+	resolve(&fragmentConfig.Process.Output.File)
+	resolve(&fragmentConfig.Control.Socket)
+}
+
+func (l *loader) merge(fragmentConfig *Config, frag *fragment) {
+	for i, gen := range fragmentConfig.Generate {
+		o := origin{fragment: frag, path: fmt.Sprintf(".generate[%d]", i)}
+
+		outputPath := filepath.Clean(filepath.Join(gen.Path, gen.Name))
+		if previous, ok := l.outputSources[outputPath]; ok {
+			l.errs = append(l.errs, o.error(&ErrorConflictingOutput{Path: outputPath, Sources: []string{previous, frag.name}}))
+			continue
+		}
+		l.outputSources[outputPath] = frag.name
+		l.config.Generate = append(l.config.Generate, gen)
+		l.generateOrigins = append(l.generateOrigins, o)
+	}
+
+	if !reflect.DeepEqual(fragmentConfig.Process, ProcessConfig{}) {
+		o := origin{fragment: frag, path: ".process"}
+		if l.processOrigin.fragment != nil {
+			l.errs = append(l.errs, o.error(&ErrorConflictingProcess{Sources: []string{l.processOrigin.fragment.name, frag.name}}))
+		} else {
+			l.processOrigin = o
+			l.config.Process = fragmentConfig.Process
+		}
+	}
+
+	l.mergeSection(frag, "watch", fragmentConfig.Watch, &l.config.Watch)
+	l.mergeSection(frag, "metrics", fragmentConfig.Metrics, &l.config.Metrics)
+	l.mergeSection(frag, "health", fragmentConfig.Health, &l.config.Health)
+	l.mergeSection(frag, "log", fragmentConfig.Log, &l.config.Log)
+	l.mergeSection(frag, "hooks", fragmentConfig.Hooks, &l.config.Hooks)
+	l.mergeSection(frag, "control", fragmentConfig.Control, &l.config.Control)
+}
+
+// mergeSection sets a top-level section of the merged config to value, unless
+// it is empty. Like the process, a section may only be set by one fragment.
+func (l *loader) mergeSection(frag *fragment, key string, value interface{}, merged interface{}) {
+	if reflect.ValueOf(value).IsZero() {
+		return
+	}
+
+	o := origin{fragment: frag, path: "." + key}
+	if previous, ok := l.sectionOrigins[key]; ok {
+		l.errs = append(l.errs, o.error(&ErrorConflictingSection{Section: key, Sources: []string{previous.fragment.name, frag.name}}))
+		return
+	}
+	l.sectionOrigins[key] = o
+	reflect.ValueOf(merged).Elem().Set(reflect.ValueOf(value))
+}
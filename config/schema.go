@@ -0,0 +1,264 @@
+package config
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SchemaID is the identifier of the published JSON Schema for shoehorn.yaml
+const SchemaID = "https://raw.githubusercontent.com/OpenSourcererPrime/shoehorn/main/shoehorn.schema.json"
+
+// JSONSchema is the subset of JSON Schema used to describe the config
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	ID                   string                 `json:"$id,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Const                interface{}            `json:"const,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+	OneOf                []*JSONSchema          `json:"oneOf,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AllOf                []*JSONSchema          `json:"allOf,omitempty"`
+	If                   *JSONSchema            `json:"if,omitempty"`
+	Then                 *JSONSchema            `json:"then,omitempty"`
+}
+
+// schemaDescriptions documents every config field, keyed by the Go type and
+// field name. A test checks that no field is missing.
+var schemaDescriptions = map[string]string{
+	"Config.Include":  "Paths or globs of config fragments to merge into this config, relative to this file",
+	"Config.Generate": "Files to generate from inputs",
+	"Config.Process":  "The process managed by shoehorn",
+	"Config.Watch":    "How inputs are watched for changes",
+	"Config.Metrics":  "Prometheus metrics endpoint",
+	"Config.Health":   "Health and readiness endpoints",
+	"Config.Log":      "How shoehorn logs",
+	"Config.Hooks":    "Commands and webhooks run on lifecycle events",
+	"Config.Control":  "Unix socket accepting commands from shoehorn ctl",
+
+	"GenerateConfig.Name":     "Name of the output file, or of the output directory when strategy is directory",
+	"GenerateConfig.Path":     "Directory of the output file",
+	"GenerateConfig.Strategy": "How the inputs are combined into the output",
+	"GenerateConfig.Template": "Path to the template file, or to the source tree of templates when strategy is directory",
+	"GenerateConfig.Inputs":   "Input files to watch, or environment variables",
+	"GenerateConfig.Mode":     "Mode of the output file, defaults to 0644",
+	"GenerateConfig.DirMode":  "Mode of created output directories, defaults to 0755",
+	"GenerateConfig.Owner":    "User name or uid of the output file",
+	"GenerateConfig.Group":    "Group name or gid of the output file",
+
+	"GenerateConfig.RefreshInterval": "Interval at which the output is rendered again even without changes, e.g. 1h. It is only written, and the process reloaded, when its content changed",
+
+	"InputFile.Name": "Template variable name of the input",
+	"InputFile.Path": "Path to the input file, or a directory or glob matching several files",
+	"InputFile.Env":  "Environment variable read instead of a file, e.g. DB_PASSWORD",
+
+	"ProcessConfig.Path":         "Path to the binary of the managed process",
+	"ProcessConfig.Reload":       "How the process is reloaded when an output changes",
+	"ProcessConfig.Args":         "Arguments for the process, arguments given to shoehorn are appended",
+	"ProcessConfig.WorkingDir":   "Working directory of the process, defaults to shoehorn's",
+	"ProcessConfig.Umask":        "Umask of the process, inherited from shoehorn when unset",
+	"ProcessConfig.Rlimits":      "Resource limits of the process, each sets both the soft and hard limit",
+	"ProcessConfig.ProcessGroup": "Start the process in its own process group and signal the whole group",
+
+	"RlimitsConfig.Nofile":  "Maximum number of open files",
+	"RlimitsConfig.Nproc":   "Maximum number of processes",
+	"RlimitsConfig.Core":    "Maximum size of core dumps in bytes",
+	"RlimitsConfig.Memlock": "Maximum locked memory in bytes",
+
+	"WatchConfig.Mode":           "Watch inputs with inotify, by polling them, or with inotify falling back to polling where it is not supported",
+	"WatchConfig.PollInterval":   "Interval between polls of inputs, e.g. 5s, defaults to 2s",
+	"WatchConfig.ResyncInterval": "Interval between full resyncs, regenerating every output that differs from its inputs, e.g. 5m",
+
+	"MetricsConfig.Listen": "Address to serve metrics on at /metrics, e.g. :9090",
+
+	"HealthConfig.Listen":         "Address to serve /healthz and /readyz on, e.g. :8080",
+	"HealthConfig.ReadinessProbe": "Check of the managed process that must also pass for shoehorn to be ready",
+
+	"ProbeConfig.Exec":    "Command run without a shell, passes when it exits with 0",
+	"ProbeConfig.HTTP":    "URL that must respond to GET with a 2xx or 3xx status",
+	"ProbeConfig.TCP":     "Address that must accept connections, e.g. localhost:5432",
+	"ProbeConfig.Timeout": "Timeout of the check, e.g. 2s, defaults to 1s",
+
+	"ProcessConfig.HealthCheck": "Periodic probe of the process, restarting it or marking shoehorn not ready after consecutive failures",
+
+	"ProcessConfig.Output": "How the stdout and stderr of the process are written",
+
+	"OutputConfig.Format":   "Write lines unchanged, prefixed with the name of the process, or as JSON objects",
+	"OutputConfig.Name":     "Name in prefixed and JSON lines, defaults to the base name of the process path",
+	"OutputConfig.File":     "Also write the output to this file, rotated by size",
+	"OutputConfig.MaxSize":  "Size in bytes at which the file is rotated, defaults to 10 MiB",
+	"OutputConfig.MaxFiles": "Number of rotated files kept, defaults to 3",
+
+	"HealthCheckConfig.Interval":    "Interval between probes, e.g. 30s, defaults to 10s",
+	"HealthCheckConfig.Retries":     "Consecutive failures before acting, defaults to 3",
+	"HealthCheckConfig.StartPeriod": "Period after the process starts in which failures are not counted, e.g. 1m",
+	"HealthCheckConfig.OnFailure":   "Restart the process, or mark shoehorn not ready until a probe passes",
+
+	"LogConfig.Format": "Log lines as text or as JSON objects, defaults to text",
+	"LogConfig.Level":  "Minimum level of logged lines, defaults to info",
+
+	"ControlConfig.Socket":           "Path of the control socket, e.g. /run/shoehorn.sock",
+	"ControlConfig.RegenerateSignal": "Signal that makes shoehorn regenerate every output and reload the process",
+
+	"HooksConfig.OnGenerate":      "Hooks run after an output was generated",
+	"HooksConfig.OnGenerateError": "Hooks run after generating an output failed",
+	"HooksConfig.OnReload":        "Hooks run after the managed process was reloaded",
+	"HooksConfig.OnProcessExit":   "Hooks run after the managed process exited",
+	"HooksConfig.OnStart":         "Hooks run after the managed process was started",
+
+	"HookConfig.Exec":    "Command run without a shell, the event is written to its stdin as JSON",
+	"HookConfig.HTTP":    "URL the event is POSTed to as JSON, a status other than 2xx fails the hook",
+	"HookConfig.Timeout": "Timeout of the hook, e.g. 30s, defaults to 10s",
+
+	"ReloadConfig.Enabled": "Whether to reload the process when an output changes",
+	"ReloadConfig.Method":  "Restart the process, or send it a signal",
+	"ReloadConfig.Signal":  "Signal sent when method is signal, e.g. SIGHUP",
+}
+
+// schemaEnums lists the allowed values of string fields
+var schemaEnums = map[string][]string{
+	"GenerateConfig.Strategy":        {"append", "template", "directory"},
+	"ReloadConfig.Method":            {"restart", "signal"},
+	"WatchConfig.Mode":               {"inotify", "poll", "auto"},
+	"HealthCheckConfig.OnFailure":    {"restart", "unready"},
+	"LogConfig.Format":               {"text", "json"},
+	"OutputConfig.Format":            {"passthrough", "prefix", "json"},
+	"LogConfig.Level":                {"debug", "info", "warn", "error"},
+	"ControlConfig.RegenerateSignal": {"SIGHUP", "SIGUSR1", "SIGUSR2"},
+}
+
+// schemaConditions adds requirements that depend on other values of a type
+var schemaConditions = map[reflect.Type][]*JSONSchema{
+	reflect.TypeOf(GenerateConfig{}): {
+		{
+			If:   &JSONSchema{Properties: map[string]*JSONSchema{"strategy": {Enum: []string{"template", "directory"}}}, Required: []string{"strategy"}},
+			Then: &JSONSchema{Required: []string{"template"}},
+		},
+	},
+	reflect.TypeOf(ProcessConfig{}): {
+		{
+			If: &JSONSchema{
+				Properties: map[string]*JSONSchema{"reload": {
+					Properties: map[string]*JSONSchema{"enabled": {Const: true}},
+					Required:   []string{"enabled"},
+				}},
+				Required: []string{"reload"},
+			},
+			Then: &JSONSchema{Required: []string{"path"}},
+		},
+	},
+	reflect.TypeOf(ProbeConfig{}): {
+		{OneOf: []*JSONSchema{{Required: []string{"exec"}}, {Required: []string{"http"}}, {Required: []string{"tcp"}}}},
+	},
+	reflect.TypeOf(InputFile{}): {
+		{OneOf: []*JSONSchema{{Required: []string{"path"}}, {Required: []string{"env"}}}},
+	},
+	reflect.TypeOf(HookConfig{}): {
+		{OneOf: []*JSONSchema{{Required: []string{"exec"}}, {Required: []string{"http"}}}},
+	},
+	reflect.TypeOf(ReloadConfig{}): {
+		{
+			If:   &JSONSchema{Properties: map[string]*JSONSchema{"enabled": {Const: true}}, Required: []string{"enabled"}},
+			Then: &JSONSchema{Required: []string{"method"}},
+		},
+		{
+			If:   &JSONSchema{Properties: map[string]*JSONSchema{"method": {Const: "signal"}}, Required: []string{"method"}},
+			Then: &JSONSchema{Required: []string{"signal"}},
+		},
+	},
+}
+
+// schemaRequired lists the fields that must always be provided
+var schemaRequired = map[reflect.Type][]string{
+	reflect.TypeOf(GenerateConfig{}): {"name", "path", "strategy"},
+}
+
+// Schema returns the JSON Schema describing shoehorn.yaml
+func Schema() *JSONSchema {
+	schema := schemaFor(reflect.TypeOf(Config{}))
+	schema.Schema = "https://json-schema.org/draft/2020-12/schema"
+	schema.ID = SchemaID
+	schema.Title = "shoehorn.yaml"
+	schema.Description = "Configuration of the shoehorn container entrypoint"
+	return schema
+}
+
+// MarshalSchema returns the JSON Schema describing shoehorn.yaml as indented JSON
+func MarshalSchema() ([]byte, error) {
+	data, err := json.MarshalIndent(Schema(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func schemaFor(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(FileMode(0)):
+		return &JSONSchema{OneOf: []*JSONSchema{
+			{Type: "string", Pattern: "^(0o?)?[0-7]{1,4}$"},
+			{Type: "integer", Minimum: new(int)},
+		}}
+	case reflect.TypeOf(time.Duration(0)):
+		return &JSONSchema{Type: "string", Pattern: "^([0-9]+(\\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$"}
+	case reflect.TypeOf(Rlimit(0)):
+		return &JSONSchema{OneOf: []*JSONSchema{
+			{Type: "integer", Minimum: new(int)},
+			{Type: "string", Const: "unlimited"},
+		}}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Slice:
+		return &JSONSchema{Type: "array", Items: schemaFor(t.Elem())}
+	case reflect.Struct:
+		schema := &JSONSchema{
+			Type:                 "object",
+			Properties:           make(map[string]*JSONSchema),
+			AdditionalProperties: new(bool),
+			Required:             schemaRequired[t],
+			AllOf:                schemaConditions[t],
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if isInline(field) {
+				inline := schemaFor(field.Type)
+				maps.Copy(schema.Properties, inline.Properties)
+				schema.Required = append(schema.Required, inline.Required...)
+				schema.AllOf = append(schema.AllOf, inline.AllOf...)
+				continue
+			}
+			key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if key == "" || key == "-" {
+				continue
+			}
+
+			name := t.Name() + "." + field.Name
+			property := schemaFor(field.Type)
+			property.Description = schemaDescriptions[name]
+			property.Enum = schemaEnums[name]
+			schema.Properties[key] = property
+		}
+		return schema
+	}
+	return &JSONSchema{}
+}
@@ -0,0 +1,479 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+)
+
+// ValidationError is a single problem found in a config, located by the
+// fragment it was loaded from and the YAML path and line of the offending value
+type ValidationError struct {
+	Source string // Config file, or "config" when loaded from a reader
+	Line   int    // 0 when the line is unknown
+	Path   string // E.g., "generate[0].strategy"
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s:%d: %s: %v", e.Source, e.Line, e.Path, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors is returned when a config is invalid, collecting every
+// problem found rather than only the first
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return "invalid config:\n" + strings.Join(messages, "\n")
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// fragment is a parsed config file, with the line of every YAML path in it
+type fragment struct {
+	name  string
+	lines map[string]int
+}
+
+// origin locates a value of the merged config in the fragment it came from
+type origin struct {
+	fragment *fragment
+	path     string
+}
+
+func (o origin) child(format string, args ...interface{}) origin {
+	return origin{fragment: o.fragment, path: o.path + fmt.Sprintf(format, args...)}
+}
+
+// error creates a ValidationError at o, using the line of the closest parent
+// path that exists when the value itself is missing from the YAML
+func (o origin) error(err error) *ValidationError {
+	validationErr := &ValidationError{Path: strings.TrimPrefix(o.path, "."), Err: err}
+	if o.fragment == nil {
+		return validationErr
+	}
+
+	validationErr.Source = o.fragment.name
+	for path := o.path; path != ""; path = parentPath(path) {
+		if line, ok := o.fragment.lines[path]; ok {
+			validationErr.Line = line
+			break
+		}
+	}
+	return validationErr
+}
+
+func parentPath(path string) string {
+	i := strings.LastIndexAny(path, ".[")
+	if i == -1 {
+		return ""
+	}
+	return path[:i]
+}
+
+// walkFields records the line of every value in node and reports keys that
+// do not correspond to a field of t
+func (f *fragment) walkFields(node ast.Node, t reflect.Type, path string) []*ValidationError {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var errs []*ValidationError
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		for _, value := range n.Values {
+			errs = append(errs, f.walkFields(value, t, path)...)
+		}
+	case *ast.MappingValueNode:
+		key := n.Key.GetToken().Value
+		keyPath := path + "." + key
+		f.lines[keyPath] = n.Key.GetToken().Position.Line
+
+		if t.Kind() != reflect.Struct {
+			break
+		}
+		field, ok := fieldByTag(t, key)
+		if !ok {
+			o := origin{fragment: f, path: keyPath}
+			errs = append(errs, o.error(&ErrorUnknownField{Field: key}))
+			break
+		}
+		errs = append(errs, f.walkFields(n.Value, field.Type, keyPath)...)
+	case *ast.SequenceNode:
+		if t.Kind() != reflect.Slice {
+			break
+		}
+		for i, value := range n.Values {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			f.lines[itemPath] = value.GetToken().Position.Line
+			errs = append(errs, f.walkFields(value, t.Elem(), itemPath)...)
+		}
+	case *ast.TagNode:
+		errs = append(errs, f.walkFields(n.Value, t, path)...)
+	case *ast.AnchorNode:
+		errs = append(errs, f.walkFields(n.Value, t, path)...)
+	}
+	return errs
+}
+
+// decodeNode decodes node into v with dec. When that fails, the fields and
+// items of node are decoded one by one so that every value that cannot be
+// decoded is reported at its own path, while the others are kept.
+func (f *fragment) decodeNode(dec *yaml.Decoder, node ast.Node, v reflect.Value, path string) []*ValidationError {
+	// The decoder leaves a pointer unset when given its address
+	if v.Kind() == reflect.Pointer {
+		if node.Type() == ast.NullType {
+			return nil
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		return f.decodeNode(dec, node, v.Elem(), path)
+	}
+
+	err := dec.DecodeFromNode(node, v.Addr().Interface())
+	if err == nil {
+		return nil
+	}
+
+	o := origin{fragment: f, path: path}
+	var yamlErr yaml.Error
+	if errors.As(err, &yamlErr) {
+		// The source is shown by the ValidationError instead
+		err = errors.New(yamlErr.GetMessage())
+	}
+	for node.Type() == ast.TagType || node.Type() == ast.AnchorType {
+		if tag, ok := node.(*ast.TagNode); ok {
+			node = tag.Value
+		} else {
+			node = node.(*ast.AnchorNode).Value
+		}
+	}
+
+	var errs []*ValidationError
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		if v.Kind() != reflect.Struct {
+			break
+		}
+		v.SetZero()
+		for _, value := range n.Values {
+			errs = append(errs, f.decodeField(dec, value, v, path)...)
+		}
+		return errs
+	case *ast.MappingValueNode:
+		if v.Kind() != reflect.Struct {
+			break
+		}
+		v.SetZero()
+		return f.decodeField(dec, n, v, path)
+	case *ast.SequenceNode:
+		if v.Kind() != reflect.Slice {
+			break
+		}
+		// Items that cannot be decoded are left empty so that the others
+		// keep the index their lines are recorded with
+		v.Set(reflect.MakeSlice(v.Type(), len(n.Values), len(n.Values)))
+		for i, value := range n.Values {
+			errs = append(errs, f.decodeNode(dec, value, v.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return errs
+	}
+	return []*ValidationError{o.error(err)}
+}
+
+// decodeField decodes the value of n into the field of v its key names.
+// Unknown keys are ignored, walkFields reports them.
+func (f *fragment) decodeField(dec *yaml.Decoder, n *ast.MappingValueNode, v reflect.Value, path string) []*ValidationError {
+	key := n.Key.GetToken().Value
+	field, ok := fieldValueByTag(v, key)
+	if !ok {
+		return nil
+	}
+	return f.decodeNode(dec, n.Value, field, path+"."+key)
+}
+
+// fieldValueByTag is fieldByTag for the fields of a struct value
+func fieldValueByTag(v reflect.Value, key string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if isInline(field) {
+			if inlineField, ok := fieldValueByTag(v.Field(i), key); ok {
+				return inlineField, true
+			}
+			continue
+		}
+		if strings.Split(field.Tag.Get("yaml"), ",")[0] == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func fieldByTag(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isInline(field) {
+			if inlineField, ok := fieldByTag(field.Type, key); ok {
+				return inlineField, true
+			}
+			continue
+		}
+		if strings.Split(field.Tag.Get("yaml"), ",")[0] == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// isInline reports whether the fields of an embedded struct are written as
+// fields of the struct embedding it
+func isInline(field reflect.StructField) bool {
+	return field.Anonymous && slices.Contains(strings.Split(field.Tag.Get("yaml"), ",")[1:], "inline")
+}
+
+// validate checks the merged config, returning every problem found
+func (l *loader) validate() error {
+	errs := l.errs
+	appConfig := l.config
+
+	for i, gen := range appConfig.Generate {
+		o := l.generateOrigins[i]
+
+		if gen.Name == "" {
+			errs = append(errs, o.child(".name").error(&ErrorMissingField{Field: "name"}))
+		}
+		if gen.Path == "" {
+			errs = append(errs, o.child(".path").error(&ErrorMissingField{Field: "path"}))
+		}
+		if gen.Strategy != "append" && gen.Strategy != "template" && gen.Strategy != "directory" {
+			errs = append(errs, o.child(".strategy").error(&ErrorInvalidStrategy{Strategy: gen.Strategy, Name: gen.Name}))
+		}
+		if (gen.Strategy == "template" || gen.Strategy == "directory") && gen.Template == "" {
+			errs = append(errs, o.child(".template").error(&ErrorMissingTemplate{Name: gen.Name}))
+		}
+		if gen.RefreshInterval < 0 {
+			errs = append(errs, o.child(".refreshInterval").error(&ErrorNegativeValue{Field: "refreshInterval"}))
+		}
+
+		inputNames := make(map[string]bool)
+		for j, input := range gen.Inputs {
+			switch {
+			case input.Path == "" && input.Env == "":
+				errs = append(errs, o.child(".inputs[%d].path", j).error(&ErrorMissingField{Field: "path"}))
+			case input.Path != "" && input.Env != "":
+				errs = append(errs, o.child(".inputs[%d].env", j).error(&ErrorConflictingInput{Path: input.Path, Env: input.Env}))
+			}
+			if input.Name == "" {
+				// Only templates refer to inputs by name
+				if gen.Strategy == "template" {
+					errs = append(errs, o.child(".inputs[%d].name", j).error(&ErrorMissingField{Field: "name"}))
+				}
+				continue
+			}
+			if inputNames[input.Name] {
+				errs = append(errs, o.child(".inputs[%d].name", j).error(&ErrorDuplicateInput{Name: input.Name, Output: gen.Name}))
+			}
+			inputNames[input.Name] = true
+		}
+	}
+
+	errs = append(errs, l.findCycles()...)
+
+	process := appConfig.Process
+	if healthCheck := process.HealthCheck; healthCheck != nil {
+		o := l.processOrigin.child(".healthCheck")
+		errs = append(errs, validateProbe(&healthCheck.ProbeConfig, o)...)
+		if healthCheck.OnFailure != "" && healthCheck.OnFailure != "restart" && healthCheck.OnFailure != "unready" {
+			errs = append(errs, o.child(".onFailure").error(&ErrorInvalidOnFailure{OnFailure: healthCheck.OnFailure}))
+		}
+		if healthCheck.Interval < 0 {
+			errs = append(errs, o.child(".interval").error(&ErrorNegativeValue{Field: "interval"}))
+		}
+		if healthCheck.StartPeriod < 0 {
+			errs = append(errs, o.child(".startPeriod").error(&ErrorNegativeValue{Field: "startPeriod"}))
+		}
+		if healthCheck.Retries < 0 {
+			errs = append(errs, o.child(".retries").error(&ErrorNegativeValue{Field: "retries"}))
+		}
+	}
+	output := process.Output
+	if output.Format != "" && output.Format != "passthrough" && output.Format != "prefix" && output.Format != "json" {
+		errs = append(errs, l.processOrigin.child(".output.format").error(&ErrorInvalidOutputFormat{Format: output.Format}))
+	}
+	if output.MaxSize < 0 {
+		errs = append(errs, l.processOrigin.child(".output.maxSize").error(&ErrorNegativeValue{Field: "maxSize"}))
+	}
+	if output.MaxFiles < 0 {
+		errs = append(errs, l.processOrigin.child(".output.maxFiles").error(&ErrorNegativeValue{Field: "maxFiles"}))
+	}
+	if process.Reload.Enabled {
+		o := l.processOrigin
+		if process.Path == "" {
+			errs = append(errs, o.child(".path").error(&ErrorMissingField{Field: "path"}))
+		}
+		if process.Reload.Method != "restart" && process.Reload.Method != "signal" {
+			errs = append(errs, o.child(".reload.method").error(&ErrorInvalidReloadMethod{Method: process.Reload.Method}))
+		}
+		if process.Reload.Method == "signal" && process.Reload.Signal == "" {
+			errs = append(errs, o.child(".reload.signal").error(&ErrorMissingSignal{}))
+		}
+	}
+
+	watch := appConfig.Watch
+	o := l.sectionOrigins["watch"]
+	if watch.Mode != "" && watch.Mode != "inotify" && watch.Mode != "poll" && watch.Mode != "auto" {
+		errs = append(errs, o.child(".mode").error(&ErrorInvalidWatchMode{Mode: watch.Mode}))
+	}
+	if watch.PollInterval < 0 {
+		errs = append(errs, o.child(".pollInterval").error(&ErrorNegativeValue{Field: "pollInterval"}))
+	}
+	if watch.ResyncInterval < 0 {
+		errs = append(errs, o.child(".resyncInterval").error(&ErrorNegativeValue{Field: "resyncInterval"}))
+	}
+
+	logConfig := appConfig.Log
+	if logConfig.Format != "" && logConfig.Format != "text" && logConfig.Format != "json" {
+		errs = append(errs, l.sectionOrigins["log"].child(".format").error(&ErrorInvalidLogFormat{Format: logConfig.Format}))
+	}
+	if logConfig.Level != "" && !slices.Contains([]string{"debug", "info", "warn", "error"}, logConfig.Level) {
+		errs = append(errs, l.sectionOrigins["log"].child(".level").error(&ErrorInvalidLogLevel{Level: logConfig.Level}))
+	}
+
+	if probe := appConfig.Health.ReadinessProbe; probe != nil {
+		errs = append(errs, validateProbe(probe, l.sectionOrigins["health"].child(".readinessProbe"))...)
+	}
+
+	if signal := appConfig.Control.RegenerateSignal; signal != "" && !slices.Contains([]string{"SIGHUP", "SIGUSR1", "SIGUSR2"}, signal) {
+		errs = append(errs, l.sectionOrigins["control"].child(".regenerateSignal").error(&ErrorInvalidRegenerateSignal{Signal: signal}))
+	}
+
+	hooks := appConfig.Hooks
+	for _, event := range []struct {
+		key   string
+		hooks []HookConfig
+	}{
+		{"onGenerate", hooks.OnGenerate},
+		{"onGenerateError", hooks.OnGenerateError},
+		{"onReload", hooks.OnReload},
+		{"onProcessExit", hooks.OnProcessExit},
+		{"onStart", hooks.OnStart},
+	} {
+		for i, hook := range event.hooks {
+			errs = append(errs, validateHook(hook, l.sectionOrigins["hooks"].child(".%s[%d]", event.key, i))...)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// findCycles reports outputs that are, directly or through other outputs,
+// inputs or templates of themselves
+func (l *loader) findCycles() []*ValidationError {
+	generate := l.config.Generate
+
+	// dependents[i] lists the entries that read the output of entry i
+	outputs := make(map[string]int)
+	for i, gen := range generate {
+		outputs[filepath.Clean(filepath.Join(gen.Path, gen.Name))] = i
+	}
+	dependents := make([][]int, len(generate))
+	for j, gen := range generate {
+		sources := []string{gen.Template}
+		for _, input := range gen.Inputs {
+			sources = append(sources, input.Path)
+		}
+		for _, source := range sources {
+			if i, ok := outputs[filepath.Clean(source)]; ok && source != "" {
+				dependents[i] = append(dependents[i], j)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(generate))
+	var errs []*ValidationError
+
+	var visit func(i int)
+	visit = func(i int) {
+		state[i] = visiting
+		for _, j := range dependents[i] {
+			switch state[j] {
+			case visiting:
+				// Reported at the entry that closes the cycle
+				outputPath := filepath.Join(generate[i].Path, generate[i].Name)
+				errs = append(errs, l.generateOrigins[j].error(&ErrorOutputCycle{Output: outputPath, Name: generate[j].Name}))
+			case unvisited:
+				visit(j)
+			}
+		}
+		state[i] = visited
+	}
+	for i := range generate {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+	return errs
+}
+
+// validateProbe checks that probe sets exactly one kind of check
+func validateProbe(probe *ProbeConfig, o origin) []*ValidationError {
+	var errs []*ValidationError
+	kinds := 0
+	for _, set := range []bool{len(probe.Exec) > 0, probe.HTTP != "", probe.TCP != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		errs = append(errs, o.error(&ErrorInvalidProbe{Kinds: kinds}))
+	}
+	if probe.Timeout < 0 {
+		errs = append(errs, o.child(".timeout").error(&ErrorNegativeValue{Field: "timeout"}))
+	}
+	return errs
+}
+
+// validateHook checks that hook sets exactly one of exec and http
+func validateHook(hook HookConfig, o origin) []*ValidationError {
+	var errs []*ValidationError
+	kinds := 0
+	for _, set := range []bool{len(hook.Exec) > 0, hook.HTTP != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		errs = append(errs, o.error(&ErrorInvalidHook{Kinds: kinds}))
+	}
+	if hook.Timeout < 0 {
+		errs = append(errs, o.child(".timeout").error(&ErrorNegativeValue{Field: "timeout"}))
+	}
+	return errs
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/OpenSourcererPrime/shoehorn/entrypoint"
+)
+
+// defaultControlSocket is used by ctl when --socket is not given
+const defaultControlSocket = "/run/shoehorn.sock"
+
+// printControlResponse writes the outputs and process state in resp as text
+func printControlResponse(w io.Writer, resp *entrypoint.ControlResponse) {
+	if len(resp.Outputs) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "OUTPUT\tSTRATEGY\tLAST GENERATED\tERROR")
+		for _, output := range resp.Outputs {
+			lastGenerated := "never"
+			if output.LastGenerated != nil {
+				lastGenerated = output.LastGenerated.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", output.Path, output.Strategy, lastGenerated, output.Error)
+		}
+		tw.Flush()
+	}
+
+	if process := resp.Process; process != nil {
+		state := "stopped"
+		if process.Running {
+			state = "running"
+		}
+		fmt.Fprintf(w, "process: %s\nstate:   %s\n", process.Path, state)
+		if process.PID != 0 {
+			fmt.Fprintf(w, "pid:     %d\nstarted: %s\n", process.PID, process.Started.Format(time.RFC3339))
+		}
+		if process.HealthCheck != "" {
+			fmt.Fprintf(w, "health:  %s\n", process.HealthCheck)
+		}
+	}
+
+	if resp.Paused {
+		fmt.Fprintln(w, "watching is paused")
+	}
+}
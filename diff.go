@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+type diffLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+// unifiedDiff returns a unified diff between the current and rendered content
+// of the output at path, or an empty string if they are the same
+func unifiedDiff(path, current, rendered string) string {
+	lines := diffLines(splitLines(current), splitLines(rendered))
+	if trailingContext(lines) == len(lines) {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s (rendered)\n", path, path)
+
+	// Walk the edit script, emitting a hunk for each run of changes together
+	// with its surrounding context
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			start++
+			continue
+		}
+
+		hunkStart := max(start-diffContext, 0)
+		hunkEnd := start
+		for unchanged := 0; hunkEnd < len(lines) && unchanged <= 2*diffContext; hunkEnd++ {
+			if lines[hunkEnd].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		// Trim trailing context beyond diffContext lines
+		for hunkEnd > start && trailingContext(lines[:hunkEnd]) > diffContext {
+			hunkEnd--
+		}
+
+		oldStart, newStart := lineNumbers(lines[:hunkStart])
+		oldCount, newCount := lineNumbers(lines[hunkStart:hunkEnd])
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", oldStart+1, oldCount, newStart+1, newCount)
+		for _, line := range lines[hunkStart:hunkEnd] {
+			fmt.Fprintf(&sb, "%c%s\n", line.op, line.text)
+		}
+		start = hunkEnd
+	}
+
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes the edit script from a to b using their longest common
+// subsequence of lines
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+	return lines
+}
+
+// lineNumbers counts the old and new lines covered by an edit script
+func lineNumbers(lines []diffLine) (int, int) {
+	oldCount, newCount := 0, 0
+	for _, line := range lines {
+		if line.op != '+' {
+			oldCount++
+		}
+		if line.op != '-' {
+			newCount++
+		}
+	}
+	return oldCount, newCount
+}
+
+func trailingContext(lines []diffLine) int {
+	count := 0
+	for i := len(lines) - 1; i >= 0 && lines[i].op == ' '; i-- {
+		count++
+	}
+	return count
+}
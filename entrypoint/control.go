@@ -0,0 +1,249 @@
+package entrypoint
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+)
+
+// controlTimeout bounds how long a control connection may take to send its
+// request
+const controlTimeout = 10 * time.Second
+
+// ControlRequest is a command sent to the control socket
+type ControlRequest struct {
+	Command string `json:"command"`          // "outputs", "process", "regenerate", "reload", "restart", "pause" or "resume"
+	Output  string `json:"output,omitempty"` // Output to regenerate, every output when empty
+}
+
+// ControlResponse is the reply to a ControlRequest
+type ControlResponse struct {
+	Error   string         `json:"error,omitempty"`
+	Outputs []OutputStatus `json:"outputs,omitempty"` // Set by outputs and regenerate
+	Process *ProcessStatus `json:"process,omitempty"` // Set by process, reload and restart
+	Paused  bool           `json:"paused"`            // Whether watching is paused
+}
+
+// OutputStatus is the state of an output
+type OutputStatus struct {
+	Path          string     `json:"path"`
+	Strategy      string     `json:"strategy"`
+	LastGenerated *time.Time `json:"lastGenerated,omitempty"` // Unset until the output was generated
+	Error         string     `json:"error,omitempty"`         // Why the last generation failed
+}
+
+// ProcessStatus is the state of the managed process
+type ProcessStatus struct {
+	Path        string     `json:"path"`
+	PID         int        `json:"pid,omitempty"`
+	Running     bool       `json:"running"`
+	Started     *time.Time `json:"started,omitempty"`
+	HealthCheck string     `json:"healthCheck,omitempty"` // Why the health check is failing
+}
+
+// ServeControl accepts commands on control.socket until Close is called. The
+// socket is not served when unset.
+func (ep *EntryPoint) ServeControl() error {
+	socket := ep.appConfig.Control.Socket
+	if socket == "" {
+		return nil
+	}
+
+	// A socket left behind by a previous run would make listening fail
+	if info, err := os.Lstat(socket); err == nil && info.Mode().Type() == fs.ModeSocket {
+		os.Remove(socket)
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return &ErrorListen{Address: socket, Err: err}
+	}
+	// Commands can restart the process, so only the owner may send them
+	err = os.Chmod(socket, 0o600)
+	if err != nil {
+		listener.Close()
+		return &ErrorListen{Address: socket, Err: err}
+	}
+	ep.controlListener = listener
+
+	slog.Info("Serving control socket", "path", socket)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					slog.Error("Control socket failed", "path", socket, "error", err)
+				}
+				return
+			}
+			go ep.handleControl(conn)
+		}
+	}()
+	return nil
+}
+
+// handleControl reads one request from conn and writes its response
+func (ep *EntryPoint) handleControl(conn net.Conn) {
+	defer conn.Close()
+
+	var req ControlRequest
+	conn.SetReadDeadline(time.Now().Add(controlTimeout))
+	err := json.NewDecoder(conn).Decode(&req)
+	if err != nil {
+		slog.Warn("Invalid control request", "error", err)
+		json.NewEncoder(conn).Encode(ControlResponse{Error: err.Error()})
+		return
+	}
+
+	slog.Info("Received control command", "command", req.Command, "output", req.Output)
+	resp := ep.control(req)
+	if resp.Error != "" {
+		slog.Warn("Control command failed", "command", req.Command, "error", resp.Error)
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
+
+// control runs the command of req
+func (ep *EntryPoint) control(req ControlRequest) ControlResponse {
+	var resp ControlResponse
+	var err error
+	switch req.Command {
+	case "outputs":
+		resp.Outputs = ep.outputStatuses()
+	case "process":
+		resp.Process = ep.processStatus()
+	case "regenerate":
+		err = ep.inWatchLoop(func() error {
+			return ep.regenerate(req.Output)
+		})
+		resp.Outputs = ep.outputStatuses()
+	case "reload":
+		err = ep.reloadManagedProcess()
+		resp.Process = ep.processStatus()
+	case "restart":
+		err = ep.restart()
+		resp.Process = ep.processStatus()
+	case "pause", "resume":
+		// Changes are collected while paused and applied on resuming
+		err = ep.inWatchLoop(func() error {
+			ep.paused.Store(req.Command == "pause")
+			return nil
+		})
+	default:
+		err = &ErrorUnknownCommand{Command: req.Command}
+	}
+
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	resp.Paused = ep.paused.Load()
+	return resp
+}
+
+// inWatchLoop runs f in WatchForChanges, which owns the changes waiting to
+// be applied, and returns its error
+func (ep *EntryPoint) inWatchLoop(f func() error) error {
+	if ep.watchStopped.Load() {
+		return &ErrorNotWatching{}
+	}
+	result := make(chan error, 1)
+	select {
+	case ep.calls <- func() { result <- f() }:
+	case <-ep.closed:
+		return &ErrorNotWatching{}
+	}
+	return <-result
+}
+
+// regenerate generates the output at outputPath, or every output when it is
+// empty, and then reloads the managed process if reload is enabled
+func (ep *EntryPoint) regenerate(outputPath string) error {
+	outputs := make(map[string][]string)
+	for _, gen := range ep.appConfig.Generate {
+		if outputPath == "" || OutputPath(gen) == outputPath {
+			outputs[OutputPath(gen)] = nil
+		}
+	}
+	if outputPath != "" && len(outputs) == 0 {
+		return &ErrorUnknownOutput{Path: outputPath}
+	}
+	ep.regenerateOutputs(outputs)
+	return nil
+}
+
+// restart restarts the managed process
+func (ep *EntryPoint) restart() error {
+	ep.processLock.Lock()
+	defer ep.processLock.Unlock()
+
+	if ep.appConfig.Process.Path == "" {
+		return &ErrorNoProcess{}
+	}
+	slog.Info("Restarting managed process")
+	return ep.restartManagedProcess()
+}
+
+func (ep *EntryPoint) outputStatuses() []OutputStatus {
+	ep.processLock.Lock()
+	generate := ep.appConfig.Generate
+	ep.processLock.Unlock()
+
+	ep.statusLock.Lock()
+	defer ep.statusLock.Unlock()
+	statuses := make([]OutputStatus, 0, len(generate))
+	for _, gen := range generate {
+		status := OutputStatus{Path: OutputPath(gen), Strategy: gen.Strategy}
+		if result, ok := ep.outputResults[status.Path]; ok {
+			status.LastGenerated = &result.time
+			if result.err != nil {
+				status.Error = result.err.Error()
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func (ep *EntryPoint) processStatus() *ProcessStatus {
+	ep.processLock.Lock()
+	status := &ProcessStatus{Path: ep.appConfig.Process.Path, Running: ep.processRunning()}
+	if ep.managedCmd != nil && ep.managedCmd.Process != nil {
+		started := ep.processStarted
+		status.PID = ep.managedCmd.Process.Pid
+		status.Started = &started
+	}
+	ep.processLock.Unlock()
+
+	ep.statusLock.Lock()
+	if ep.healthCheckErr != nil {
+		status.HealthCheck = ep.healthCheckErr.Error()
+	}
+	ep.statusLock.Unlock()
+	return status
+}
+
+// Control sends req to the control socket at socket and returns the response
+func Control(socket string, req ControlRequest) (*ControlResponse, error) {
+	conn, err := net.DialTimeout("unix", socket, controlTimeout)
+	if err != nil {
+		return nil, &ErrorControl{Socket: socket, Err: err}
+	}
+	defer conn.Close()
+
+	err = json.NewEncoder(conn).Encode(req)
+	if err != nil {
+		return nil, &ErrorControl{Socket: socket, Err: err}
+	}
+	var resp ControlResponse
+	err = json.NewDecoder(conn).Decode(&resp)
+	if err != nil {
+		return nil, &ErrorControl{Socket: socket, Err: err}
+	}
+	if resp.Error != "" {
+		return &resp, &ErrorControl{Socket: socket, Err: errors.New(resp.Error)}
+	}
+	return &resp, nil
+}
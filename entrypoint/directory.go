@@ -0,0 +1,277 @@
+package entrypoint
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/OpenSourcererPrime/shoehorn/config"
+)
+
+// hiddenSource reports whether path is a hidden entry of the source tree of
+// gen, e.g. the ..data and ..<timestamp> entries of a Kubernetes volume
+func hiddenSource(gen config.GenerateConfig, path string) bool {
+	return path != gen.Template && strings.HasPrefix(filepath.Base(path), ".")
+}
+
+// parseDirectoryTemplates parses every regular file in the source tree of
+// gen, keyed by its path relative to the tree. Hidden entries are skipped, and
+// symlinks are followed to files but not to directories, which is how mounted
+// volumes expose files.
+func parseDirectoryTemplates(gen config.GenerateConfig) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+	err := filepath.WalkDir(gen.Template, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return &ErrorReadTemplate{Path: path, Err: err}
+		}
+		if hiddenSource(gen, path) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+		}
+
+		relPath, err := filepath.Rel(gen.Template, path)
+		if err != nil {
+			return err
+		}
+
+		templateData, err := os.ReadFile(path)
+		if err != nil {
+			return &ErrorReadTemplate{Path: path, Err: err}
+		}
+		tmpl, err := template.New(relPath).Parse(string(templateData))
+		if err != nil {
+			return &ErrorParseTemplate{Path: path, Err: err}
+		}
+		templates[relPath] = tmpl
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// renderDirectory renders every file in the source tree of gen with the
+// inputs as context, keyed by the path it would be written to
+func renderDirectory(gen config.GenerateConfig) (map[string][]byte, error) {
+	templates, err := parseDirectoryTemplates(gen)
+	if err != nil {
+		return nil, err
+	}
+
+	context := templateContext(gen)
+	outputs := make(map[string][]byte, len(templates))
+	for relPath, tmpl := range templates {
+		var buffer bytes.Buffer
+		err = tmpl.Execute(&buffer, context)
+		if err != nil {
+			return nil, &ErrorExecuteTemplate{Path: filepath.Join(gen.Template, relPath), Err: err}
+		}
+		outputs[filepath.Join(OutputPath(gen), relPath)] = buffer.Bytes()
+	}
+	return outputs, nil
+}
+
+// manifestPath returns the path of the file listing what was generated for
+// gen, kept beside the output tree so that it is never part of it
+func manifestPath(gen config.GenerateConfig) string {
+	outputDir := OutputPath(gen)
+	return filepath.Join(filepath.Dir(outputDir), "."+filepath.Base(outputDir)+".shoehorn")
+}
+
+// generatedFiles returns the files last generated for gen, as listed by its
+// manifest. Nothing was generated yet when the manifest does not exist.
+func generatedFiles(gen config.GenerateConfig) ([]string, error) {
+	data, err := os.ReadFile(manifestPath(gen))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, relPath := range strings.Split(string(data), "\n") {
+		if relPath == "" {
+			continue
+		}
+		path, ok := manifestEntryPath(gen, relPath)
+		if !ok {
+			slog.Warn("Ignoring manifest entry outside the output tree", "name", gen.Name, "output", OutputPath(gen), "path", manifestPath(gen), "entry", relPath)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// manifestEntryPath returns the path of a file listed by the manifest of gen.
+// Entries that are absolute, contain "..", or lead outside the output tree
+// through a symlinked directory are rejected, as the files they name are
+// removed once no longer rendered.
+func manifestEntryPath(gen config.GenerateConfig, relPath string) (string, bool) {
+	if !filepath.IsLocal(relPath) || slices.Contains(strings.Split(filepath.ToSlash(relPath), "/"), "..") {
+		return "", false
+	}
+
+	outputDir := OutputPath(gen)
+	path := filepath.Join(outputDir, relPath)
+	root, err := filepath.EvalSymlinks(outputDir)
+	if err == nil {
+		var dir string
+		dir, err = filepath.EvalSymlinks(filepath.Dir(path))
+		if err == nil {
+			relDir, err := filepath.Rel(root, dir)
+			return path, err == nil && filepath.IsLocal(relDir)
+		}
+	}
+	// A file in a directory that does not exist is never removed
+	return path, errors.Is(err, fs.ErrNotExist)
+}
+
+// writeManifest records paths as the files generated for gen
+func writeManifest(gen config.GenerateConfig, paths []string) error {
+	var buffer bytes.Buffer
+	for _, path := range paths {
+		relPath, err := filepath.Rel(OutputPath(gen), path)
+		if err != nil {
+			return err
+		}
+		buffer.WriteString(relPath + "\n")
+	}
+	return writeOutput(config.GenerateConfig{}, manifestPath(gen), buffer.Bytes())
+}
+
+// StaleOutputs returns the files previously generated for a directory
+// strategy that are no longer rendered from the source tree and would be
+// removed. Files in the output tree that shoehorn did not generate are never
+// stale.
+func StaleOutputs(gen config.GenerateConfig, outputs map[string][]byte) []string {
+	if gen.Strategy != "directory" {
+		return nil
+	}
+
+	generated, err := generatedFiles(gen)
+	if err != nil {
+		slog.Warn("Failed to read the files generated for output", "name", gen.Name, "output", OutputPath(gen), "path", manifestPath(gen), "error", err)
+	}
+	var stale []string
+	for _, path := range generated {
+		if _, ok := outputs[path]; ok {
+			continue
+		}
+		if _, err := os.Lstat(path); err == nil {
+			stale = append(stale, path)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// generateDirectory renders the source tree of gen into its output tree,
+// removing the files it generated that no longer exist in the source tree and
+// the directories they leave empty
+func generateDirectory(gen config.GenerateConfig) error {
+	outputDir := OutputPath(gen)
+
+	outputs, err := renderDirectory(gen)
+	if err != nil {
+		slog.Error("Failed to render output", "name", gen.Name, "output", outputDir, "strategy", gen.Strategy, "error", err)
+		return err
+	}
+
+	warnLooserMode(gen)
+
+	var errs []error
+	var generated []string
+	dirMode := gen.DirMode.OrDefault(defaultDirMode)
+	for outputPath, data := range outputs {
+		err = makeDirs(filepath.Dir(outputPath), dirMode)
+		if err == nil {
+			err = writeOutput(gen, outputPath, data)
+		}
+		if err != nil {
+			slog.Error("Failed to write output file", "name", gen.Name, "output", outputDir, "path", outputPath, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		generated = append(generated, outputPath)
+	}
+
+	for _, stalePath := range StaleOutputs(gen, outputs) {
+		slog.Info("Removing file no longer in the source tree", "name", gen.Name, "output", outputDir, "path", stalePath, "template", gen.Template)
+		err = os.Remove(stalePath)
+		if err != nil {
+			slog.Error("Failed to remove output file", "name", gen.Name, "output", outputDir, "path", stalePath, "error", err)
+			errs = append(errs, err)
+			// Removing it is tried again on the next generation
+			generated = append(generated, stalePath)
+			continue
+		}
+		removeEmptyDirs(outputDir, filepath.Dir(stalePath))
+	}
+
+	sort.Strings(generated)
+	err = makeDirs(filepath.Dir(outputDir), dirMode)
+	if err == nil {
+		err = writeManifest(gen, generated)
+	}
+	if err != nil {
+		slog.Error("Failed to record the files generated for output", "name", gen.Name, "output", outputDir, "path", manifestPath(gen), "error", err)
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	slog.Info("Generated output", "name", gen.Name, "output", outputDir, "strategy", gen.Strategy)
+	return nil
+}
+
+// removeEmptyDirs removes dir and its parents below root while they are
+// empty, once the file removed from dir left them empty
+func removeEmptyDirs(root, dir string) {
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			return
+		}
+		os.Remove(dir)
+		dir = filepath.Dir(dir)
+	}
+}
+
+// sourceDirs returns every directory of the source tree of gen that is not
+// hidden, so each can be watched for added, changed and removed templates
+func sourceDirs(gen config.GenerateConfig) []string {
+	var dirs []string
+	filepath.WalkDir(gen.Template, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+		if hiddenSource(gen, path) {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+	return dirs
+}
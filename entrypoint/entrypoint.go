@@ -1,10 +1,14 @@
 package entrypoint
 
 import (
-	"log"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -13,60 +17,133 @@ import (
 )
 
 type EntryPoint struct {
-	managedCmd *exec.Cmd
-	appConfig  config.Config
-	watcher    *fsnotify.Watcher
+	managedCmd   *exec.Cmd
+	managedDone  chan struct{} // Closed once managedCmd has exited
+	expectedExit atomic.Bool   // Set while shoehorn itself is stopping the process
+	processLock  sync.Mutex
+	appConfig    config.Config
+	watcher      *fsnotify.Watcher
+	poller       *poller // Watches paths where inotify is not used
+	// Paths that do not exist yet, mapped to the existing parent watched
+	// until they appear
+	missing map[string]string
+
+	metrics *entryPointMetrics
+	servers []*http.Server // Serve metrics and health endpoints
+
+	watchStopped atomic.Bool  // Set once WatchForChanges has returned
+	heartbeat    atomic.Int64 // Unix time in nanoseconds WatchForChanges was last responsive
+	paused       atomic.Bool  // Set while changes are collected but not applied
+	calls        chan func()  // Run by WatchForChanges, see inWatchLoop
+
+	controlListener net.Listener // Accepts commands on control.socket
+
+	statusLock     sync.Mutex
+	outputResults  map[string]outputResult // Result of the last generation of each output
+	healthCheckErr error                   // Set while a failing health check makes shoehorn not ready
+
+	processStarted  time.Time // When the managed process was last started
+	healthCheckOnce sync.Once
+	processExit     chan error    // Receives the result of the process exiting on its own
+	closed          chan struct{} // Closed by Close to stop background goroutines
+	closeOnce       sync.Once
+
+	// Set by WatchConfig to reload the config when it changes
+	configPath string
+	extraArgs  []string
+	configDirs map[string]bool
 }
 
+// NewEntryPoint watches the inputs of appConfig. The outputs are generated by
+// GenerateOutputs.
 func NewEntryPoint(appConfig *config.Config) (*EntryPoint, error) {
 	ep := &EntryPoint{
-		appConfig: *appConfig,
+		appConfig:   *appConfig,
+		missing:     make(map[string]string),
+		metrics:     newEntryPointMetrics(),
+		processExit: make(chan error, 1),
+		closed:      make(chan struct{}),
+		calls:       make(chan func()),
 	}
 
 	// Setup file watcher
-	ep.setupWatcher()
-
-	// Generate initial files
-	ep.generateAllFiles()
-
+	err := ep.setupWatcher()
+	if err != nil {
+		return nil, err
+	}
 	return ep, nil
 }
 
+// Close stops watching, serving and the managed process. It may be called
+// more than once.
 func (ep *EntryPoint) Close() {
-	if ep.watcher != nil {
-		ep.watcher.Close()
-	}
-	if ep.managedCmd != nil && ep.managedCmd.Process != nil {
-		ep.managedCmd.Process.Kill()
-	}
+	ep.closeOnce.Do(func() {
+		close(ep.closed)
+		if ep.watcher != nil {
+			ep.watcher.Close()
+		}
+		if ep.poller != nil {
+			ep.poller.Close()
+		}
+		for _, server := range ep.servers {
+			server.Close()
+		}
+		if ep.controlListener != nil {
+			ep.controlListener.Close()
+		}
+		ep.processLock.Lock()
+		defer ep.processLock.Unlock()
+		ep.stopManagedProcess(syscall.SIGKILL, stopTimeout)
+	})
 }
 
-func (ep *EntryPoint) HandleSignals() {
+// HandleSignals waits for SIGINT or SIGTERM and returns once the managed
+// process stopped. Until then control.regenerateSignal regenerates every
+// output and reloads the process. When the managed process exits on its own
+// HandleSignals returns as well, with an ErrorProcessExited if it failed.
+func (ep *EntryPoint) HandleSignals() error {
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signalChan)
+	regenerateSignal, regenerate := signalsByName[ep.appConfig.Control.RegenerateSignal]
+	if regenerate {
+		signal.Notify(signalChan, regenerateSignal)
+	}
 
-	sig := <-signalChan
-	log.Printf("Received signal: %v, shutting down...", sig)
-
-	// Forward the signal to the managed process if it exists
-	if ep.managedCmd != nil && ep.managedCmd.Process != nil {
-		log.Printf("Forwarding signal to managed process")
-		ep.managedCmd.Process.Signal(sig)
-
-		// Give the process a short time to exit gracefully
-		done := make(chan error, 1)
-		go func() {
-			done <- ep.managedCmd.Wait()
-		}()
-
+	var sig os.Signal
+	for {
 		select {
-		case <-done:
-			log.Printf("Managed process exited gracefully")
-		case <-time.After(5 * time.Second):
-			log.Printf("Timeout waiting for managed process to exit, forcing termination")
-			ep.managedCmd.Process.Kill()
+		case err := <-ep.processExit:
+			return err
+		case sig = <-signalChan:
 		}
+		if !regenerate || sig != regenerateSignal {
+			break
+		}
+		slog.Info("Received signal, regenerating all outputs", "signal", sig.String())
+		// Keep handling signals while the outputs are generated
+		go ep.forceRegenerate()
+	}
+	slog.Info("Received signal, shutting down", "signal", sig.String())
+
+	// Forward the signal to the managed process and give it a short time to
+	// exit gracefully
+	ep.processLock.Lock()
+	if ep.managedCmd != nil && ep.managedCmd.Process != nil {
+		slog.Info("Forwarding signal to managed process", "signal", sig.String(), "pid", ep.managedCmd.Process.Pid)
+		ep.stopManagedProcess(sig.(syscall.Signal), stopTimeout)
 	}
+	ep.processLock.Unlock()
+	return nil
+}
 
-	os.Exit(0)
+// forceRegenerate generates every output, whether or not its inputs changed,
+// and then reloads the managed process if reload is enabled
+func (ep *EntryPoint) forceRegenerate() {
+	err := ep.inWatchLoop(func() error {
+		return ep.regenerate("")
+	})
+	if err != nil {
+		slog.Error("Failed to regenerate outputs", "error", err)
+	}
 }
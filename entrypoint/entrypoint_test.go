@@ -1,24 +1,51 @@
 package entrypoint
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/OpenSourcererPrime/shoehorn/config"
+	"github.com/fsnotify/fsnotify"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
+// TestMain applies the limits of managed processes started by the tests, as
+// the main function of shoehorn does
+func TestMain(m *testing.M) {
+	if limits, ok := os.LookupEnv(LimitsEnv); ok {
+		ExecWithLimits(limits)
+		os.Exit(127)
+	}
+	os.Exit(m.Run())
+}
+
 func TestEntryPointWithEmptyConfig(t *testing.T) {
 	cfg := &config.Config{}
 
 	// Create EntryPoint with empty config
 	ep, err := NewEntryPoint(cfg)
 	require.NoError(t, err)
+	require.NotNil(t, ep)
 	defer ep.Close()
-
-	assert.NotNil(t, ep)
+	require.NoError(t, ep.GenerateOutputs())
 	assert.NotNil(t, ep.watcher)
 	assert.Equal(t, *cfg, ep.appConfig)
 }
@@ -51,6 +78,8 @@ func TestEntryPointWithInvalidTemplate(t *testing.T) {
 
 	ep, err := NewEntryPoint(cfg)
 	require.NoError(t, err)
+	var parseErr *ErrorParseTemplate
+	assert.ErrorAs(t, ep.GenerateOutputs(), &parseErr)
 	defer ep.Close()
 
 	assert.NotNil(t, ep)
@@ -92,6 +121,7 @@ func TestEntryPointWithInvalidWatchPath(t *testing.T) {
 	ep, err := NewEntryPoint(cfg)
 	require.NoError(t, err)
 	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
 
 	assert.NotNil(t, ep)
 
@@ -101,6 +131,108 @@ func TestEntryPointWithInvalidWatchPath(t *testing.T) {
 	assert.Equal(t, "test content\n", string(content))
 }
 
+func TestEntryPointOutputPermissions(t *testing.T) {
+	testDir := t.TempDir()
+
+	inputFile := filepath.Join(testDir, "secret.txt")
+	err := os.WriteFile(inputFile, []byte("password"), 0o600)
+	require.NoError(t, err)
+
+	outputDir := filepath.Join(testDir, "out")
+	outputPath := filepath.Join(outputDir, "output.txt")
+
+	// Pre-create a world-readable output to check the mode is enforced
+	err = os.MkdirAll(outputDir, 0o755)
+	require.NoError(t, err)
+	err = os.WriteFile(outputPath, []byte("stale"), 0o666)
+	require.NoError(t, err)
+	staleFile, err := os.Open(outputPath)
+	require.NoError(t, err)
+	defer staleFile.Close()
+
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:     "output.txt",
+				Path:     outputDir,
+				Strategy: "append",
+				Mode:     0o600,
+				Owner:    strconv.Itoa(os.Getuid()),
+				Group:    strconv.Itoa(os.Getgid()),
+				Inputs: []config.InputFile{
+					{Name: "secret", Path: inputFile},
+				},
+			},
+		},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
+
+	info, err := os.Stat(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	content, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, "password\n", string(content))
+
+	// The secret was never written to the world-readable file, which was
+	// replaced instead
+	content, err = io.ReadAll(staleFile)
+	require.NoError(t, err)
+	assert.Equal(t, "stale", string(content))
+	entries, err := os.ReadDir(outputDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files are removed")
+}
+
+func TestEntryPointCreatesOutputDirWithDirMode(t *testing.T) {
+	testDir := t.TempDir()
+
+	inputFile := filepath.Join(testDir, "input.txt")
+	err := os.WriteFile(inputFile, []byte("test content"), 0o644)
+	require.NoError(t, err)
+
+	outputDir := filepath.Join(testDir, "nested", "out")
+
+	// The umask does not reduce the mode of created directories
+	oldUmask := syscall.Umask(0o077)
+	defer syscall.Umask(oldUmask)
+
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:     "output.txt",
+				Path:     outputDir,
+				Strategy: "append",
+				DirMode:  0o750,
+				Inputs: []config.InputFile{
+					{Name: "input", Path: inputFile},
+				},
+			},
+		},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
+
+	for _, dir := range []string{filepath.Join(testDir, "nested"), outputDir} {
+		info, err := os.Stat(dir)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o750), info.Mode().Perm(), dir)
+	}
+
+	// Existing directories keep their mode
+	info, err := os.Stat(testDir)
+	require.NoError(t, err)
+	assert.NotEqual(t, os.FileMode(0o750), info.Mode().Perm())
+}
+
 func TestEntryPointWithReadOnlyOutputDir(t *testing.T) {
 	testDir := t.TempDir()
 
@@ -131,6 +263,7 @@ func TestEntryPointWithReadOnlyOutputDir(t *testing.T) {
 	ep, err := NewEntryPoint(cfg)
 	require.NoError(t, err)
 	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
 
 	assert.NotNil(t, ep)
 }
@@ -160,9 +293,11 @@ func TestEntryPointWithNoProcess(t *testing.T) {
 	ep, err := NewEntryPoint(cfg)
 	require.NoError(t, err)
 	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
 
 	// Try to start a process - should not crash
-	ep.StartManagedProcess()
+	err = ep.StartManagedProcess()
+	require.NoError(t, err)
 
 	// Try to reload - should not crash
 	ep.reloadManagedProcess()
@@ -170,3 +305,1444 @@ func TestEntryPointWithNoProcess(t *testing.T) {
 	// Verify EntryPoint has no managed command
 	assert.Nil(t, ep.managedCmd)
 }
+
+func TestStartWithLimits(t *testing.T) {
+	testDir := t.TempDir()
+
+	umask := config.FileMode(0o027)
+	core := config.Rlimit(0)
+	processConfig := config.ProcessConfig{
+		Path:       "sh",
+		Args:       []string{"-c", "pwd; umask; ulimit -c"},
+		WorkingDir: testDir,
+		Umask:      &umask,
+		Rlimits: config.RlimitsConfig{
+			Core: &core,
+		},
+	}
+
+	var ownCore unix.Rlimit
+	require.NoError(t, unix.Getrlimit(unix.RLIMIT_CORE, &ownCore))
+	ownUmask := syscall.Umask(0o022)
+	syscall.Umask(ownUmask)
+
+	var stdout bytes.Buffer
+	c := newManagedCmd(processConfig)
+	c.Stdout = &stdout
+
+	err := startWithLimits(c, processConfig)
+	require.NoError(t, err)
+	require.NoError(t, c.Wait())
+
+	assert.Equal(t, testDir+"\n0027\n0\n", stdout.String())
+
+	// Only the child is limited
+	var coreNow unix.Rlimit
+	require.NoError(t, unix.Getrlimit(unix.RLIMIT_CORE, &coreNow))
+	assert.Equal(t, ownCore, coreNow)
+	umaskNow := syscall.Umask(0o022)
+	syscall.Umask(umaskNow)
+	assert.Equal(t, ownUmask, umaskNow)
+
+	// Limits that cannot be applied fail the start
+	nofile := config.Rlimit(1 << 40)
+	processConfig.Rlimits = config.RlimitsConfig{Nofile: &nofile}
+	err = startWithLimits(newManagedCmd(processConfig), processConfig)
+	assert.ErrorContains(t, err, "failed to set nofile limit")
+}
+
+func TestEntryPointReportsProcessExit(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		script   string
+		exitCode int
+	}{
+		{"success", "exit 0", 0},
+		{"failure", "exit 3", 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ep, err := NewEntryPoint(&config.Config{
+				Process: config.ProcessConfig{Path: "sh", Args: []string{"-c", tc.script}},
+			})
+			require.NoError(t, err)
+			defer ep.Close()
+			require.NoError(t, ep.GenerateOutputs())
+
+			require.NoError(t, ep.StartManagedProcess())
+			err = ep.HandleSignals()
+			if tc.exitCode == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var exitErr *ErrorProcessExited
+			require.ErrorAs(t, err, &exitErr)
+			var processErr *exec.ExitError
+			require.ErrorAs(t, err, &processErr)
+			assert.Equal(t, tc.exitCode, processErr.ExitCode())
+		})
+	}
+}
+
+func TestEntryPointCloseTwice(t *testing.T) {
+	ep, err := NewEntryPoint(&config.Config{})
+	require.NoError(t, err)
+
+	ep.Close()
+	assert.NotPanics(t, ep.Close)
+}
+
+// processAlive reports whether pid is running, treating zombies as exited
+func processAlive(pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+// startForkingProcess starts a managed shell that forks a long running child
+// and returns the pid of that child
+func startForkingProcess(t *testing.T, processGroup bool) (*EntryPoint, int) {
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+
+	cfg := &config.Config{
+		Process: config.ProcessConfig{
+			Path:         "sh",
+			Args:         []string{"-c", "sleep 60 & echo $! > " + pidFile + "; wait"},
+			ProcessGroup: processGroup,
+		},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	t.Cleanup(ep.Close)
+
+	err = ep.StartManagedProcess()
+	require.NoError(t, err)
+
+	var childPid int
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(pidFile)
+		if err != nil {
+			return false
+		}
+		childPid, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.True(t, processAlive(childPid))
+
+	return ep, childPid
+}
+
+func TestSignalProcessGroup(t *testing.T) {
+	ep, childPid := startForkingProcess(t, true)
+
+	// Keep the exit of the managed process from terminating the test binary
+	ep.expectedExit.Store(true)
+	err := ep.signalManagedProcess(syscall.SIGTERM)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool { return !processAlive(childPid) }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestStopManagedProcessKillsDescendants(t *testing.T) {
+	for _, processGroup := range []bool{true, false} {
+		t.Run(fmt.Sprintf("processGroup=%v", processGroup), func(t *testing.T) {
+			ep, childPid := startForkingProcess(t, processGroup)
+
+			ep.stopManagedProcess(syscall.SIGTERM, time.Second)
+
+			assert.Eventually(t, func() bool { return !processAlive(childPid) }, 5*time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestStopManagedProcessSignalsDescendantsGracefully(t *testing.T) {
+	testDir := t.TempDir()
+	readyFile := filepath.Join(testDir, "ready")
+	termFile := filepath.Join(testDir, "term")
+
+	// Without a process group the child only learns of the shutdown from
+	// the signal forwarded to it
+	child := "trap 'echo term > " + termFile + "; exit 0' TERM; sleep 60 & touch " + readyFile + "; wait"
+	cfg := &config.Config{
+		Process: config.ProcessConfig{
+			Path: "sh",
+			Args: []string{"-c", "sh -c \"" + child + "\" & wait"},
+		},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.StartManagedProcess())
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(readyFile)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ep.stopManagedProcess(syscall.SIGTERM, 5*time.Second)
+
+	content, err := os.ReadFile(termFile)
+	require.NoError(t, err)
+	assert.Equal(t, "term\n", string(content))
+}
+
+func TestProcessIDIgnoresReusedPid(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	require.NoError(t, cmd.Start())
+	defer cmd.Process.Kill()
+
+	process, ok := findProcess(cmd.Process.Pid)
+	require.True(t, ok)
+	assert.True(t, process.running())
+
+	// The same pid with another start time is a different process
+	reused := processID{pid: process.pid, startTime: process.startTime + 1}
+	assert.False(t, reused.running())
+	reused.signal(syscall.SIGKILL)
+	assert.True(t, process.running())
+	assert.Empty(t, findDescendants(reused))
+}
+
+func TestStartManagedProcessReturnsError(t *testing.T) {
+	cfg := &config.Config{
+		Process: config.ProcessConfig{
+			Path: filepath.Join(t.TempDir(), "does-not-exist"),
+		},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
+
+	err = ep.StartManagedProcess()
+	var startErr *ErrorStartProcess
+	require.ErrorAs(t, err, &startErr)
+	assert.Equal(t, cfg.Process.Path, startErr.Path)
+	assert.Nil(t, ep.managedCmd)
+}
+
+func TestRenderFileReturnsTypedErrors(t *testing.T) {
+	testDir := t.TempDir()
+
+	invalidTemplate := filepath.Join(testDir, "invalid.tmpl")
+	err := os.WriteFile(invalidTemplate, []byte("{{.input"), 0o644)
+	require.NoError(t, err)
+
+	_, err = RenderFile(config.GenerateConfig{
+		Name:     "output.txt",
+		Strategy: "template",
+		Template: filepath.Join(testDir, "missing.tmpl"),
+	})
+	var readErr *ErrorReadTemplate
+	assert.ErrorAs(t, err, &readErr)
+
+	_, err = RenderFile(config.GenerateConfig{
+		Name:     "output.txt",
+		Strategy: "template",
+		Template: invalidTemplate,
+	})
+	var parseErr *ErrorParseTemplate
+	assert.ErrorAs(t, err, &parseErr)
+
+	err = writeOutput(config.GenerateConfig{Owner: "shoehorn-no-such-user"}, filepath.Join(testDir, "output.txt"), nil)
+	var lookupErr *ErrorLookupOwner
+	assert.ErrorAs(t, err, &lookupErr)
+}
+
+func TestEntryPointReloadsConfig(t *testing.T) {
+	testDir := t.TempDir()
+	outputDir := filepath.Join(testDir, "out")
+
+	inputFile := filepath.Join(testDir, "input.txt")
+	err := os.WriteFile(inputFile, []byte("test content"), 0o644)
+	require.NoError(t, err)
+
+	configPath := filepath.Join(testDir, "shoehorn.yaml")
+	writeConfig := func(strategy string, sleep string, outputs ...string) {
+		content := "generate:\n"
+		for _, output := range outputs {
+			content += "  - name: " + output + "\n    path: " + outputDir + "\n    strategy: " + strategy + "\n" +
+				"    inputs:\n      - name: input\n        path: " + inputFile + "\n"
+		}
+		content += "process:\n  path: sleep\n  args: [\"" + sleep + "\"]\n"
+		require.NoError(t, os.WriteFile(configPath, []byte(content), 0o644))
+	}
+
+	writeConfig("append", "60", "a.txt")
+	cfg, err := config.LoadConfigFile(configPath)
+	require.NoError(t, err)
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
+
+	require.NoError(t, ep.StartManagedProcess())
+	ep.WatchConfig(configPath, nil)
+	go ep.WatchForChanges()
+
+	managedPid := func() int {
+		ep.processLock.Lock()
+		defer ep.processLock.Unlock()
+		return ep.managedCmd.Process.Pid
+	}
+	initialPid := managedPid()
+
+	// Adding an output generates it without restarting the process
+	writeConfig("append", "60", "a.txt", "b.txt")
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(outputDir, "b.txt"))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, initialPid, managedPid())
+
+	// An invalid config is rejected and the running config is kept
+	writeConfig("unknown", "60", "a.txt")
+	time.Sleep(500 * time.Millisecond)
+	ep.processLock.Lock()
+	assert.Len(t, ep.appConfig.Generate, 2)
+	ep.processLock.Unlock()
+
+	// Changing the process settings restarts the process
+	writeConfig("append", "120", "a.txt")
+	assert.Eventually(t, func() bool { return managedPid() != initialPid }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestEntryPointOnlyReloadsForConfigSources(t *testing.T) {
+	testDir := t.TempDir()
+	fragmentDir := filepath.Join(testDir, "shoehorn.d")
+	require.NoError(t, os.MkdirAll(fragmentDir, 0o755))
+	configPath := filepath.Join(testDir, "shoehorn.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("include:\n  - shoehorn.d/*.yaml\n"), 0o644))
+	fragmentPath := filepath.Join(fragmentDir, "app.yaml")
+	require.NoError(t, os.WriteFile(fragmentPath, []byte("watch:\n  mode: poll\n"), 0o644))
+
+	cfg, err := config.LoadConfigFile(configPath)
+	require.NoError(t, err)
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	ep.WatchConfig(configPath, nil)
+
+	for _, tc := range []struct {
+		name   string
+		reload bool
+	}{
+		{configPath, true},
+		{fragmentPath, true},
+		{filepath.Join(fragmentDir, "new.yaml"), true},
+		{filepath.Join(testDir, "..data"), true},
+		{filepath.Join(testDir, ".shoehorn.yaml.swp"), false},
+		{filepath.Join(fragmentDir, ".#app.yaml"), false},
+		{filepath.Join(fragmentDir, "notes.txt"), false},
+		{filepath.Join(testDir, "output.txt"), false},
+	} {
+		assert.Equal(t, tc.reload, ep.isConfigEvent(fsnotify.Event{Name: tc.name, Op: fsnotify.Write}), tc.name)
+	}
+}
+
+func TestEntryPointAppliesConfigSections(t *testing.T) {
+	cfg := &config.Config{
+		Metrics: config.MetricsConfig{Listen: "127.0.0.1:9090"},
+		Control: config.ControlConfig{Socket: "/run/shoehorn.sock"},
+	}
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
+
+	newConfig := *cfg
+	newConfig.Metrics.Listen = "127.0.0.1:9091"
+	newConfig.Log.Level = "debug"
+	newConfig.Hooks.OnReload = []config.HookConfig{{Exec: []string{"true"}}}
+	newConfig.Health.ReadinessProbe = &config.ProbeConfig{TCP: "127.0.0.1:8080"}
+	ep.applyConfig(&newConfig)
+
+	// Hooks and the readiness probe are applied, startup settings are kept
+	assert.Equal(t, newConfig.Hooks, ep.appConfig.Hooks)
+	assert.Equal(t, newConfig.Health.ReadinessProbe, ep.appConfig.Health.ReadinessProbe)
+	assert.Equal(t, cfg.Metrics, ep.appConfig.Metrics)
+	assert.Equal(t, cfg.Log, ep.appConfig.Log)
+	assert.Equal(t, cfg.Control, ep.appConfig.Control)
+}
+
+func TestEntryPointWithGlobAndDirectoryInputs(t *testing.T) {
+	testDir := t.TempDir()
+	confDir := filepath.Join(testDir, "conf.d")
+	require.NoError(t, os.MkdirAll(confDir, 0o755))
+
+	files := map[string]string{
+		"b.yaml":  "b: 2",
+		"a.yaml":  "a: 1\n",
+		"c.txt":   "not matched by the glob\n",
+		".hidden": "skipped in directories\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(confDir, name), []byte(content), 0o644))
+	}
+
+	templateFile := filepath.Join(testDir, "output.tmpl")
+	err := os.WriteFile(templateFile, []byte("{{range $name, $content := .confd}}{{$name}}={{$content}}{{end}}"), 0o644)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:     "glob.txt",
+				Path:     testDir,
+				Strategy: "append",
+				Inputs: []config.InputFile{
+					{Name: "confd", Path: filepath.Join(confDir, "*.yaml")},
+				},
+			},
+			{
+				Name:     "dir.txt",
+				Path:     testDir,
+				Strategy: "template",
+				Template: templateFile,
+				Inputs: []config.InputFile{
+					{Name: "confd", Path: confDir},
+				},
+			},
+		},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
+
+	content, err := os.ReadFile(filepath.Join(testDir, "glob.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "a: 1\nb: 2\n", string(content))
+
+	content, err = os.ReadFile(filepath.Join(testDir, "dir.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "a.yaml=a: 1\nb.yaml=b: 2c.txt=not matched by the glob\n", string(content))
+
+	go ep.WatchForChanges()
+
+	// Adding and removing files in the directory regenerates the outputs
+	err = os.WriteFile(filepath.Join(confDir, "0.yaml"), []byte("zero: 0\n"), 0o644)
+	require.NoError(t, err)
+	err = os.Remove(filepath.Join(confDir, "b.yaml"))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(filepath.Join(testDir, "glob.txt"))
+		return err == nil && string(content) == "zero: 0\na: 1\n"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestEntryPointWithDirectoryStrategy(t *testing.T) {
+	testDir := t.TempDir()
+	sourceDir := filepath.Join(testDir, "templates")
+	outputDir := filepath.Join(testDir, "output")
+	require.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "sites"), 0o755))
+
+	inputFile := filepath.Join(testDir, "input.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("example.com"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "main.conf"), []byte("include sites/*;\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "sites", "default.conf"), []byte("server_name {{.host}};\n"), 0o644))
+
+	// A file shoehorn did not generate, e.g. shipped with the image
+	foreignFile := filepath.Join(outputDir, "sites", "mime.types")
+	require.NoError(t, os.MkdirAll(filepath.Dir(foreignFile), 0o755))
+	require.NoError(t, os.WriteFile(foreignFile, []byte("types {}\n"), 0o644))
+
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:     "output",
+				Path:     testDir,
+				Strategy: "directory",
+				Template: sourceDir,
+				Inputs: []config.InputFile{
+					{Name: "host", Path: inputFile},
+				},
+			},
+		},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
+
+	content, err := os.ReadFile(filepath.Join(outputDir, "main.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "include sites/*;\n", string(content))
+
+	content, err = os.ReadFile(filepath.Join(outputDir, "sites", "default.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "server_name example.com;\n", string(content))
+
+	assert.FileExists(t, foreignFile)
+	// Only generated files would be removed once no longer rendered
+	assert.Equal(t, []string{
+		filepath.Join(outputDir, "main.conf"),
+		filepath.Join(outputDir, "sites", "default.conf"),
+	}, StaleOutputs(cfg.Generate[0], nil))
+
+	go ep.WatchForChanges()
+
+	// Removing a template from the source tree removes it from the output,
+	// while the file shoehorn did not generate survives
+	require.NoError(t, os.Remove(filepath.Join(sourceDir, "sites", "default.conf")))
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(outputDir, "sites", "default.conf"))
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.FileExists(t, filepath.Join(outputDir, "main.conf"))
+	assert.FileExists(t, foreignFile)
+
+	// Directories left empty by removed files are removed
+	require.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "extra"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "extra", "extra.conf"), []byte("extra\n"), 0o644))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(outputDir, "extra", "extra.conf"))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, os.RemoveAll(filepath.Join(sourceDir, "extra")))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(outputDir, "extra"))
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.FileExists(t, foreignFile)
+}
+
+func TestEntryPointWithConfigMapDirectoryStrategy(t *testing.T) {
+	testDir := t.TempDir()
+	sourceDir := filepath.Join(testDir, "templates")
+	outputDir := filepath.Join(testDir, "output")
+
+	// The layout of a mounted ConfigMap: visible files are symlinks through
+	// ..data to a hidden directory holding the current version
+	writeVersion := func(version, content string) {
+		versionDir := filepath.Join(sourceDir, version)
+		require.NoError(t, os.MkdirAll(versionDir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(versionDir, "main.conf"), []byte(content), 0o644))
+		require.NoError(t, os.Symlink(version, filepath.Join(sourceDir, "..data_tmp")))
+		require.NoError(t, os.Rename(filepath.Join(sourceDir, "..data_tmp"), filepath.Join(sourceDir, "..data")))
+	}
+	writeVersion("..2026_10_19_00_00_00.1", "one\n")
+	require.NoError(t, os.Symlink(filepath.Join("..data", "main.conf"), filepath.Join(sourceDir, "main.conf")))
+
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:     "output",
+				Path:     testDir,
+				Strategy: "directory",
+				Template: sourceDir,
+			},
+		},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
+
+	content, err := os.ReadFile(filepath.Join(outputDir, "main.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "one\n", string(content))
+
+	entries, err := os.ReadDir(outputDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "main.conf", entries[0].Name())
+
+	go ep.WatchForChanges()
+
+	// An update swaps ..data to a new version directory
+	writeVersion("..2026_10_19_00_01_00.2", "two\n")
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(filepath.Join(outputDir, "main.conf"))
+		return err == nil && string(content) == "two\n"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDirectoryStrategyKeepsManifestInOutputTree(t *testing.T) {
+	testDir := t.TempDir()
+	sourceDir := filepath.Join(testDir, "templates")
+	outputDir := filepath.Join(testDir, "output")
+	require.NoError(t, os.MkdirAll(sourceDir, 0o755))
+	require.NoError(t, os.MkdirAll(outputDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "main.conf"), []byte("main\n"), 0o644))
+
+	// Files outside the output tree, named by a tampered manifest directly and
+	// through a symlinked directory
+	victim := filepath.Join(testDir, "victim")
+	require.NoError(t, os.WriteFile(victim, []byte("keep\n"), 0o644))
+	require.NoError(t, os.Symlink(testDir, filepath.Join(outputDir, "link")))
+	manifest := strings.Join([]string{"../victim", victim, "sites/../../victim", "link/victim"}, "\n")
+	require.NoError(t, os.WriteFile(filepath.Join(testDir, ".output.shoehorn"), []byte(manifest), 0o644))
+
+	gen := config.GenerateConfig{
+		Name:     "output",
+		Path:     testDir,
+		Strategy: "directory",
+		Template: sourceDir,
+	}
+	assert.Empty(t, StaleOutputs(gen, nil))
+
+	require.NoError(t, generateDirectory(gen))
+	assert.FileExists(t, victim)
+	assert.FileExists(t, filepath.Join(outputDir, "main.conf"))
+
+	paths, err := generatedFiles(gen)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(outputDir, "main.conf")}, paths)
+}
+
+func TestEntryPointPollsInputs(t *testing.T) {
+	testDir := t.TempDir()
+	inputFile := filepath.Join(testDir, "input.txt")
+	outputFile := filepath.Join(testDir, "output.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("one\n"), 0o644))
+
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:     "output.txt",
+				Path:     testDir,
+				Strategy: "append",
+				Inputs:   []config.InputFile{{Path: inputFile}},
+			},
+		},
+		Watch: config.WatchConfig{Mode: "poll", PollInterval: 20 * time.Millisecond},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
+
+	assert.Empty(t, ep.watcher.WatchList())
+	assert.Equal(t, []string{inputFile}, ep.poller.WatchList())
+
+	go ep.WatchForChanges()
+
+	// A change keeping the size and modification time is found by its hash
+	info, err := os.Stat(inputFile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(inputFile, []byte("two\n"), 0o644))
+	require.NoError(t, os.Chtimes(inputFile, info.ModTime(), info.ModTime()))
+
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(outputFile)
+		return err == nil && string(content) == "two\n"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestEntryPointPollsMissingInputs(t *testing.T) {
+	testDir := t.TempDir()
+	missingFile := filepath.Join(testDir, "token")
+	templateFile := filepath.Join(testDir, "output.tmpl")
+	outputFile := filepath.Join(testDir, "output.txt")
+
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:     "output.txt",
+				Path:     testDir,
+				Strategy: "template",
+				Template: templateFile,
+				Inputs:   []config.InputFile{{Name: "token", Path: missingFile}},
+			},
+		},
+		Watch: config.WatchConfig{Mode: "poll", PollInterval: 20 * time.Millisecond},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	assert.Error(t, ep.GenerateOutputs())
+	defer ep.Close()
+
+	go ep.WatchForChanges()
+
+	// The template and the input are used once they are created
+	require.NoError(t, os.WriteFile(templateFile, []byte("token={{.token}}\n"), 0o644))
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(outputFile)
+		return err == nil && string(content) == "token=\n"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(missingFile, []byte("secret"), 0o644))
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(outputFile)
+		return err == nil && string(content) == "token=secret\n"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestEntryPointResyncsOutputs(t *testing.T) {
+	testDir := t.TempDir()
+	inputFile := filepath.Join(testDir, "input.txt")
+	outputFile := filepath.Join(testDir, "output.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("input\n"), 0o644))
+
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:     "output.txt",
+				Path:     testDir,
+				Strategy: "append",
+				Inputs:   []config.InputFile{{Path: inputFile}},
+			},
+		},
+		Watch: config.WatchConfig{ResyncInterval: 20 * time.Millisecond},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
+
+	go ep.WatchForChanges()
+
+	// The output is not watched, so only a resync restores it
+	require.NoError(t, os.WriteFile(outputFile, []byte("edited\n"), 0o644))
+
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(outputFile)
+		return err == nil && string(content) == "input\n"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestEntryPointWatchesMissingInputs(t *testing.T) {
+	testDir := t.TempDir()
+	inputFile := filepath.Join(testDir, "input.txt")
+	missingFile := filepath.Join(testDir, "secrets", "token")
+	outputFile := filepath.Join(testDir, "output.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("input\n"), 0o644))
+
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:     "output.txt",
+				Path:     testDir,
+				Strategy: "append",
+				Inputs: []config.InputFile{
+					{Path: inputFile},
+					{Path: missingFile},
+				},
+			},
+		},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
+
+	assert.Equal(t, map[string]string{missingFile: testDir}, ep.missing)
+
+	go ep.WatchForChanges()
+
+	// The input is watched and used once it and its directory are created
+	require.NoError(t, os.MkdirAll(filepath.Dir(missingFile), 0o755))
+	require.NoError(t, os.WriteFile(missingFile, []byte("token\n"), 0o644))
+
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(outputFile)
+		return err == nil && string(content) == "input\ntoken\n"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A removed and recreated input is still watched
+	require.NoError(t, os.Remove(missingFile))
+	require.NoError(t, os.WriteFile(missingFile, []byte("new token\n"), 0o644))
+
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(outputFile)
+		return err == nil && string(content) == "input\nnew token\n"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(missingFile, []byte("rotated\n"), 0o644))
+
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(outputFile)
+		return err == nil && string(content) == "input\nrotated\n"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestEntryPointRecordsMetrics(t *testing.T) {
+	testDir := t.TempDir()
+	inputFile := filepath.Join(testDir, "input.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("input\n"), 0o644))
+
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:     "output.txt",
+				Path:     testDir,
+				Strategy: "append",
+				Inputs:   []config.InputFile{{Path: inputFile}},
+			},
+			{
+				Name:     "broken.txt",
+				Path:     testDir,
+				Strategy: "template",
+				Template: filepath.Join(testDir, "missing.tmpl"),
+			},
+		},
+		Process: config.ProcessConfig{
+			Path:   "/bin/sh",
+			Args:   []string{"-c", "exec sleep 10"},
+			Reload: config.ReloadConfig{Enabled: true, Method: "restart"},
+		},
+		Metrics: config.MetricsConfig{Listen: "127.0.0.1:0"},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	assert.Error(t, ep.GenerateOutputs())
+	defer ep.Close()
+	require.NoError(t, ep.Serve())
+	require.NoError(t, ep.StartManagedProcess())
+
+	ep.reloadManagedProcess()
+
+	var sb strings.Builder
+	_, err = ep.metrics.registry.WriteTo(&sb)
+	require.NoError(t, err)
+	text := sb.String()
+
+	outputFile := filepath.Join(testDir, "output.txt")
+	brokenFile := filepath.Join(testDir, "broken.txt")
+	assert.Contains(t, text, fmt.Sprintf("shoehorn_generations_total{output=%q} 1\n", outputFile))
+	assert.Contains(t, text, fmt.Sprintf("shoehorn_generations_total{output=%q} 1\n", brokenFile))
+	assert.Contains(t, text, fmt.Sprintf("shoehorn_generation_failures_total{output=%q} 1\n", brokenFile))
+	assert.NotContains(t, text, fmt.Sprintf("shoehorn_generation_failures_total{output=%q}", outputFile))
+	assert.Contains(t, text, fmt.Sprintf("shoehorn_render_duration_seconds_count{output=%q} 1\n", outputFile))
+	assert.Contains(t, text, `shoehorn_reloads_total{method="restart",result="success"} 1`)
+	assert.Contains(t, text, "shoehorn_process_restarts_total 1\n")
+	assert.Contains(t, text, "shoehorn_process_last_exit_code 143\n")
+	assert.Contains(t, text, "# TYPE shoehorn_uptime_seconds gauge\n")
+	assert.Contains(t, text, "# TYPE shoehorn_process_uptime_seconds gauge\n")
+
+	// The process uptime is 0 once the process stopped
+	assert.Positive(t, ep.metrics.processUptime())
+	ep.Close()
+	assert.Zero(t, ep.metrics.processUptime())
+}
+
+func TestEntryPointHealthEndpoints(t *testing.T) {
+	testDir := t.TempDir()
+	inputFile := filepath.Join(testDir, "input.txt")
+	templateFile := filepath.Join(testDir, "output.tmpl")
+	require.NoError(t, os.WriteFile(inputFile, []byte("input\n"), 0o644))
+
+	probeStatus := http.StatusServiceUnavailable
+	probeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(probeStatus)
+	}))
+	defer probeServer.Close()
+
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:     "output.txt",
+				Path:     testDir,
+				Strategy: "template",
+				Template: templateFile,
+				Inputs:   []config.InputFile{{Name: "input", Path: inputFile}},
+			},
+		},
+		Process: config.ProcessConfig{
+			Path: "/bin/sh",
+			Args: []string{"-c", "exec sleep 10"},
+		},
+		Health: config.HealthConfig{
+			ReadinessProbe: &config.ProbeConfig{HTTP: probeServer.URL},
+		},
+	}
+
+	get := func(handler http.HandlerFunc) (int, string) {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	// The template does not exist yet
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	assert.Error(t, ep.GenerateOutputs())
+	defer ep.Close()
+
+	code, body := get(ep.handleReadyz)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "output "+filepath.Join(testDir, "output.txt")+" failed to generate")
+	assert.Contains(t, body, "managed process is not running")
+
+	require.NoError(t, os.WriteFile(templateFile, []byte("{{.input}}"), 0o644))
+	require.NoError(t, ep.GenerateOutputs())
+	require.NoError(t, ep.StartManagedProcess())
+
+	code, body = get(ep.handleReadyz)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "readiness probe "+probeServer.URL+" failed: status 503 Service Unavailable\n", body)
+
+	probeStatus = http.StatusOK
+	code, body = get(ep.handleReadyz)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok\n", body)
+
+	code, _ = get(ep.handleHealthz)
+	assert.Equal(t, http.StatusOK, code)
+
+	// A watch loop that stopped recording heartbeats is stuck
+	ep.heartbeat.Store(time.Now().Add(-2 * heartbeatTimeout).UnixNano())
+	code, body = get(ep.handleHealthz)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "watching for changes is stuck")
+	ep.heartbeat.Store(time.Now().UnixNano())
+	code, _ = get(ep.handleHealthz)
+	assert.Equal(t, http.StatusOK, code)
+
+	// An output whose inputs all disappeared is not ready
+	require.NoError(t, os.Remove(inputFile))
+	ep.GenerateOutputs()
+	code, body = get(ep.handleReadyz)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "every input of output '"+filepath.Join(testDir, "output.txt")+"' is missing")
+
+	ep.watchStopped.Store(true)
+	code, body = get(ep.handleHealthz)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "no longer watching for changes\n", body)
+}
+
+func TestRunProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+
+	assert.NoError(t, runProbe(&config.ProbeConfig{Exec: []string{"true"}}))
+	assert.NoError(t, runProbe(&config.ProbeConfig{TCP: address}))
+
+	var probeErr *ErrorProbe
+	err = runProbe(&config.ProbeConfig{Exec: []string{"sh", "-c", "echo not ready; exit 1"}})
+	require.ErrorAs(t, err, &probeErr)
+	assert.Equal(t, "probe sh -c echo not ready; exit 1 failed: exit status 1: not ready", err.Error())
+
+	err = runProbe(&config.ProbeConfig{Exec: []string{"sleep", "10"}, Timeout: 50 * time.Millisecond})
+	assert.ErrorAs(t, err, &probeErr)
+
+	listener.Close()
+	err = runProbe(&config.ProbeConfig{TCP: address})
+	assert.ErrorAs(t, err, &probeErr)
+}
+
+func TestEntryPointHealthCheck(t *testing.T) {
+	var healthy atomic.Bool
+	probeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer probeServer.Close()
+
+	for _, onFailure := range []string{"restart", "unready"} {
+		t.Run(onFailure, func(t *testing.T) {
+			healthy.Store(false)
+			cfg := &config.Config{
+				Process: config.ProcessConfig{
+					Path: "/bin/sh",
+					Args: []string{"-c", "exec sleep 10"},
+					HealthCheck: &config.HealthCheckConfig{
+						ProbeConfig: config.ProbeConfig{HTTP: probeServer.URL},
+						Interval:    10 * time.Millisecond,
+						Retries:     2,
+						OnFailure:   onFailure,
+					},
+				},
+			}
+
+			ep, err := NewEntryPoint(cfg)
+			require.NoError(t, err)
+			defer ep.Close()
+			require.NoError(t, ep.GenerateOutputs())
+			require.NoError(t, ep.StartManagedProcess())
+
+			if onFailure == "restart" {
+				assert.Eventually(t, func() bool {
+					var sb strings.Builder
+					ep.metrics.registry.WriteTo(&sb)
+					return strings.Contains(sb.String(), "shoehorn_process_restarts_total 1\n")
+				}, 5*time.Second, 10*time.Millisecond)
+				return
+			}
+
+			assert.Eventually(t, func() bool {
+				reasons := ep.notReadyReasons()
+				return len(reasons) == 1 && strings.HasPrefix(reasons[0], "health check probe "+probeServer.URL+" failed")
+			}, 5*time.Second, 10*time.Millisecond)
+
+			// A passing probe makes shoehorn ready again
+			healthy.Store(true)
+			assert.Eventually(t, func() bool {
+				return len(ep.notReadyReasons()) == 0
+			}, 5*time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestOutputCapture(t *testing.T) {
+	testDir := t.TempDir()
+	logFile := filepath.Join(testDir, "app.log")
+
+	for _, tc := range []struct {
+		format         string
+		stdout, stderr string
+	}{
+		{"prefix", "[app] one\n[app] two\n", "[app] partial\n"},
+		{"passthrough", "one\ntwo\n", "partial\n"},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			processConfig := config.ProcessConfig{
+				Path:   "/usr/bin/app",
+				Output: config.OutputConfig{Format: tc.format, File: logFile},
+			}
+			capture, err := newOutputCapture(processConfig, func() {})
+			require.NoError(t, err)
+			var stdout, stderr bytes.Buffer
+			capture.stdout, capture.stderr = &stdout, &stderr
+
+			// Lines are written whole even when written in parts, and a
+			// final line without a newline is kept
+			c := exec.Command("sh", "-c", `printf 'one\ntw'; sleep 0.05; printf 'o\n'; sleep 0.05; printf partial >&2`)
+			c.Stdout, err = capture.pipe("stdout")
+			require.NoError(t, err)
+			c.Stderr, err = capture.pipe("stderr")
+			require.NoError(t, err)
+			require.NoError(t, c.Start())
+			c.Stdout.(*os.File).Close()
+			c.Stderr.(*os.File).Close()
+			capture.start()
+
+			require.NoError(t, c.Wait())
+			capture.wait(5 * time.Second)
+			assert.Equal(t, tc.stdout, stdout.String())
+			assert.Equal(t, tc.stderr, stderr.String())
+
+			content, err := os.ReadFile(logFile)
+			require.NoError(t, err)
+			assert.Contains(t, string(content), tc.stdout)
+		})
+	}
+}
+
+func TestOutputCaptureJSON(t *testing.T) {
+	capture, err := newOutputCapture(config.ProcessConfig{
+		Path:   "/usr/bin/app",
+		Output: config.OutputConfig{Format: "json", Name: "web"},
+	}, func() {})
+	require.NoError(t, err)
+	var stderr bytes.Buffer
+	capture.stderr = &stderr
+
+	capture.write(outputLine{stream: "stderr", text: `say "hi"`})
+
+	var record map[string]string
+	require.NoError(t, json.Unmarshal(stderr.Bytes(), &record))
+	assert.Equal(t, "web", record["process"])
+	assert.Equal(t, "stderr", record["stream"])
+	assert.Equal(t, `say "hi"`, record["message"])
+	assert.NotEmpty(t, record["time"])
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	file, err := openRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	defer file.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := file.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	// Each line exceeds the size together with the previous one, and only
+	// two rotated files are kept
+	for name, expected := range map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	} {
+		content, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content))
+	}
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestEntryPointRunsHooks(t *testing.T) {
+	var lock sync.Mutex
+	events := make(map[string][]hookEvent)
+	hookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var event hookEvent
+		if !assert.NoError(t, json.NewDecoder(req.Body).Decode(&event)) {
+			return
+		}
+		assert.Equal(t, event.Event, req.Header.Get("X-Shoehorn-Event"))
+		lock.Lock()
+		events[event.Event] = append(events[event.Event], event)
+		lock.Unlock()
+	}))
+	defer hookServer.Close()
+	received := func(name string) []hookEvent {
+		lock.Lock()
+		defer lock.Unlock()
+		return events[name]
+	}
+
+	testDir := t.TempDir()
+	inputFile := filepath.Join(testDir, "input.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("input\n"), 0o644))
+	exitFile := filepath.Join(testDir, "exit.json")
+
+	hook := []config.HookConfig{{HTTP: hookServer.URL}}
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:     "output.txt",
+				Path:     testDir,
+				Strategy: "append",
+				Inputs:   []config.InputFile{{Path: inputFile}},
+			},
+			{
+				Name:     "broken.txt",
+				Path:     testDir,
+				Strategy: "template",
+				Template: filepath.Join(testDir, "missing.tmpl"),
+			},
+		},
+		Process: config.ProcessConfig{
+			Path:   "/bin/sh",
+			Args:   []string{"-c", "exec sleep 10"},
+			Reload: config.ReloadConfig{Enabled: true, Method: "restart"},
+		},
+		Hooks: config.HooksConfig{
+			OnGenerate:      hook,
+			OnGenerateError: hook,
+			OnReload:        hook,
+			OnStart:         hook,
+			OnProcessExit:   []config.HookConfig{{Exec: []string{"sh", "-c", `cat > ` + exitFile + `; test "$SHOEHORN_EVENT" = onProcessExit`}}},
+		},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	assert.Error(t, ep.GenerateOutputs())
+	defer ep.Close()
+	require.NoError(t, ep.StartManagedProcess())
+
+	outputFile := filepath.Join(testDir, "output.txt")
+	ep.regenerateOutputs(map[string][]string{outputFile: {inputFile}})
+
+	assert.Eventually(t, func() bool {
+		return len(received("onGenerate")) == 2 && len(received("onStart")) == 2 && len(received("onReload")) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Hooks run concurrently, so the initial generation may arrive last
+	generated := received("onGenerate")
+	if generated[0].Inputs != nil {
+		generated[0], generated[1] = generated[1], generated[0]
+	}
+	assert.Nil(t, generated[0].Inputs)
+	assert.Equal(t, outputFile, generated[1].Output)
+	assert.Equal(t, []string{inputFile}, generated[1].Inputs)
+	// SHA-256 of "input\n"
+	assert.Equal(t, map[string]string{outputFile: "7d3f9b6284c6f36e77b425cac882e8fbbcc97a4727ec20790853076d0f463453"}, generated[1].Hashes)
+
+	failed := received("onGenerateError")
+	require.Len(t, failed, 1)
+	assert.Equal(t, filepath.Join(testDir, "broken.txt"), failed[0].Output)
+	assert.Contains(t, failed[0].Error, "missing.tmpl")
+
+	reload := received("onReload")[0]
+	assert.Equal(t, "restart", reload.Method)
+	assert.Empty(t, reload.Error)
+
+	// The process stopped by the restart ran the exit hook
+	assert.Eventually(t, func() bool {
+		data, err := os.ReadFile(exitFile)
+		if err != nil {
+			return false
+		}
+		var event hookEvent
+		return json.Unmarshal(data, &event) == nil && event.Event == "onProcessExit" && event.ExitCode != nil && *event.ExitCode == 143
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRunHookFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	err := runHook(config.HookConfig{HTTP: server.URL}, "onStart", []byte("{}"))
+	var hookErr *ErrorHook
+	require.ErrorAs(t, err, &hookErr)
+	assert.Contains(t, err.Error(), "502")
+
+	err = runHook(config.HookConfig{Exec: []string{"sh", "-c", "echo refused; exit 1"}}, "onStart", []byte("{}"))
+	require.ErrorAs(t, err, &hookErr)
+	assert.Contains(t, err.Error(), "refused")
+
+	err = runHook(config.HookConfig{Exec: []string{"sleep", "10"}, Timeout: 50 * time.Millisecond}, "onStart", []byte("{}"))
+	require.ErrorAs(t, err, &hookErr)
+}
+
+func TestEntryPointControlSocket(t *testing.T) {
+	testDir := t.TempDir()
+	inputFile := filepath.Join(testDir, "input.txt")
+	outputFile := filepath.Join(testDir, "output.txt")
+	socket := filepath.Join(testDir, "shoehorn.sock")
+	require.NoError(t, os.WriteFile(inputFile, []byte("input\n"), 0o644))
+
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:     "output.txt",
+				Path:     testDir,
+				Strategy: "append",
+				Inputs:   []config.InputFile{{Path: inputFile}},
+			},
+		},
+		Process: config.ProcessConfig{
+			Path:   "/bin/sh",
+			Args:   []string{"-c", "exec sleep 10"},
+			Reload: config.ReloadConfig{Method: "restart"},
+		},
+		Control: config.ControlConfig{Socket: socket},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
+	require.NoError(t, ep.ServeControl())
+	require.NoError(t, ep.StartManagedProcess())
+	go ep.WatchForChanges()
+
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	resp, err := Control(socket, ControlRequest{Command: "outputs"})
+	require.NoError(t, err)
+	require.Len(t, resp.Outputs, 1)
+	assert.Equal(t, outputFile, resp.Outputs[0].Path)
+	assert.NotNil(t, resp.Outputs[0].LastGenerated)
+	assert.Empty(t, resp.Outputs[0].Error)
+
+	resp, err = Control(socket, ControlRequest{Command: "process"})
+	require.NoError(t, err)
+	assert.True(t, resp.Process.Running)
+	pid := resp.Process.PID
+	assert.NotZero(t, pid)
+
+	resp, err = Control(socket, ControlRequest{Command: "reload"})
+	require.NoError(t, err)
+	assert.NotEqual(t, pid, resp.Process.PID)
+
+	// Changes made while paused are applied once resumed
+	resp, err = Control(socket, ControlRequest{Command: "pause"})
+	require.NoError(t, err)
+	assert.True(t, resp.Paused)
+	require.NoError(t, os.WriteFile(inputFile, []byte("paused\n"), 0o644))
+	time.Sleep(300 * time.Millisecond)
+	content, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, "input\n", string(content))
+
+	resp, err = Control(socket, ControlRequest{Command: "resume"})
+	require.NoError(t, err)
+	assert.False(t, resp.Paused)
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(outputFile)
+		return err == nil && string(content) == "paused\n"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Regenerating restores an output edited by hand
+	require.NoError(t, os.WriteFile(outputFile, []byte("edited\n"), 0o644))
+	_, err = Control(socket, ControlRequest{Command: "regenerate", Output: outputFile})
+	require.NoError(t, err)
+	content, err = os.ReadFile(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, "paused\n", string(content))
+
+	_, err = Control(socket, ControlRequest{Command: "regenerate", Output: "/etc/unknown"})
+	assert.ErrorContains(t, err, "no output is generated at '/etc/unknown'")
+
+	_, err = Control(socket, ControlRequest{Command: "stop"})
+	assert.ErrorContains(t, err, "unknown command 'stop'")
+}
+
+func TestEntryPointRegenerateSignal(t *testing.T) {
+	testDir := t.TempDir()
+	inputFile := filepath.Join(testDir, "input.txt")
+	outputFile := filepath.Join(testDir, "output.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("input\n"), 0o644))
+
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:     "output.txt",
+				Path:     testDir,
+				Strategy: "append",
+				Inputs:   []config.InputFile{{Path: inputFile}},
+			},
+		},
+		Control: config.ControlConfig{RegenerateSignal: "SIGUSR1"},
+	}
+
+	// Catch the signal before HandleSignals does, as it would otherwise
+	// terminate the test
+	caught := make(chan os.Signal, 1)
+	signal.Notify(caught, syscall.SIGUSR1)
+	defer signal.Stop(caught)
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
+	go ep.WatchForChanges()
+	go ep.HandleSignals()
+
+	// The output is not watched, so only regenerating restores it
+	require.NoError(t, os.WriteFile(outputFile, []byte("edited\n"), 0o644))
+
+	assert.Eventually(t, func() bool {
+		require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+		content, err := os.ReadFile(outputFile)
+		return err == nil && string(content) == "input\n"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestEntryPointRefreshesOutputs(t *testing.T) {
+	testDir := t.TempDir()
+	inputFile := filepath.Join(testDir, "input.txt")
+	outputFile := filepath.Join(testDir, "output.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("input\n"), 0o644))
+
+	cfg := &config.Config{
+		Generate: []config.GenerateConfig{
+			{
+				Name:            "output.txt",
+				Path:            testDir,
+				Strategy:        "append",
+				Inputs:          []config.InputFile{{Path: inputFile}},
+				RefreshInterval: 20 * time.Millisecond,
+			},
+		},
+		Process: config.ProcessConfig{
+			Path:   "/bin/sh",
+			Args:   []string{"-c", "exec sleep 10"},
+			Reload: config.ReloadConfig{Enabled: true, Method: "restart"},
+		},
+	}
+
+	ep, err := NewEntryPoint(cfg)
+	require.NoError(t, err)
+	defer ep.Close()
+	require.NoError(t, ep.GenerateOutputs())
+	require.NoError(t, ep.StartManagedProcess())
+	go ep.WatchForChanges()
+
+	restarts := func() string {
+		var sb strings.Builder
+		ep.metrics.registry.WriteTo(&sb)
+		for _, line := range strings.Split(sb.String(), "\n") {
+			if strings.HasPrefix(line, "shoehorn_process_restarts_total") {
+				return line
+			}
+		}
+		return ""
+	}
+
+	// Refreshes that render the same content do not reload the process
+	time.Sleep(200 * time.Millisecond)
+	assert.Empty(t, restarts())
+
+	// The output is not watched, so only a refresh restores it
+	require.NoError(t, os.WriteFile(outputFile, []byte("edited\n"), 0o644))
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(outputFile)
+		return err == nil && string(content) == "input\n" && restarts() == "shoehorn_process_restarts_total 1"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDueRefreshes(t *testing.T) {
+	testDir := t.TempDir()
+	ep := &EntryPoint{appConfig: config.Config{Generate: []config.GenerateConfig{
+		{Name: "hourly.txt", Path: testDir, Strategy: "append", RefreshInterval: time.Hour},
+		{Name: "minutely.txt", Path: testDir, Strategy: "append", RefreshInterval: time.Minute},
+		{Name: "never.txt", Path: testDir, Strategy: "append"},
+	}}}
+	minutely := filepath.Join(testDir, "minutely.txt")
+	hourly := filepath.Join(testDir, "hourly.txt")
+
+	now := time.Now()
+	refreshes := make(map[string]time.Time)
+	outdated, wait := ep.dueRefreshes(refreshes, now)
+	assert.Empty(t, outdated)
+	assert.Equal(t, time.Minute, wait)
+	assert.Len(t, refreshes, 2)
+
+	// Neither output exists, so both render differently once due
+	outdated, wait = ep.dueRefreshes(refreshes, now.Add(time.Minute))
+	assert.Equal(t, []string{minutely}, outdated)
+	assert.Equal(t, time.Minute, wait)
+
+	outdated, _ = ep.dueRefreshes(refreshes, now.Add(time.Hour))
+	assert.ElementsMatch(t, []string{hourly, minutely}, outdated)
+
+	// Outputs no longer refreshed are forgotten
+	ep.appConfig.Generate = ep.appConfig.Generate[2:]
+	_, wait = ep.dueRefreshes(refreshes, now)
+	assert.Zero(t, wait)
+	assert.Empty(t, refreshes)
+}
+
+func TestRenderFileWithEnvInputs(t *testing.T) {
+	t.Setenv("SHOEHORN_TEST_PASSWORD", "hunter2")
+	t.Setenv("SHOEHORN_TEST_REGION", "eu-west-1")
+	testDir := t.TempDir()
+
+	data, err := RenderFile(config.GenerateConfig{
+		Name:     "output.txt",
+		Strategy: "append",
+		Inputs: []config.InputFile{
+			{Env: "SHOEHORN_TEST_PASSWORD"},
+			{Env: "SHOEHORN_TEST_UNSET"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2\n", string(data))
+
+	templateFile := filepath.Join(testDir, "output.tmpl")
+	require.NoError(t, os.WriteFile(templateFile, []byte("password={{.password}} region={{.Env.SHOEHORN_TEST_REGION}}"), 0o644))
+	gen := config.GenerateConfig{
+		Name:     "output.txt",
+		Path:     testDir,
+		Strategy: "template",
+		Template: templateFile,
+		Inputs:   []config.InputFile{{Name: "password", Env: "SHOEHORN_TEST_PASSWORD"}},
+	}
+	data, err = RenderFile(gen)
+	require.NoError(t, err)
+	assert.Equal(t, "password=hunter2 region=eu-west-1", string(data))
+
+	// Only the template is watched
+	assert.Equal(t, []string{templateFile}, generateWatchTargets(gen))
+}
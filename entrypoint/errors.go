@@ -0,0 +1,233 @@
+package entrypoint
+
+import (
+	"fmt"
+)
+
+// ErrorCreateWatcher is returned when the file watcher cannot be created
+type ErrorCreateWatcher struct {
+	Err error
+}
+
+func (e *ErrorCreateWatcher) Error() string {
+	return fmt.Sprintf("failed to create file watcher: %v", e.Err)
+}
+
+func (e *ErrorCreateWatcher) Unwrap() error {
+	return e.Err
+}
+
+// ErrorStartProcess is returned when the managed process cannot be started
+type ErrorStartProcess struct {
+	Path string
+	Err  error
+}
+
+func (e *ErrorStartProcess) Error() string {
+	return fmt.Sprintf("failed to start managed process '%s': %v", e.Path, e.Err)
+}
+
+func (e *ErrorStartProcess) Unwrap() error {
+	return e.Err
+}
+
+// ErrorProcessExited is returned when the managed process failed without
+// being stopped by shoehorn
+type ErrorProcessExited struct {
+	PID int
+	Err error
+}
+
+func (e *ErrorProcessExited) Error() string {
+	return fmt.Sprintf("managed process %d exited: %v", e.PID, e.Err)
+}
+
+func (e *ErrorProcessExited) Unwrap() error {
+	return e.Err
+}
+
+// ErrorInputsMissing is recorded for an output whose inputs are all missing
+type ErrorInputsMissing struct {
+	Output string
+}
+
+func (e *ErrorInputsMissing) Error() string {
+	return fmt.Sprintf("every input of output '%s' is missing", e.Output)
+}
+
+// ErrorSetRlimit is returned when a resource limit cannot be applied
+type ErrorSetRlimit struct {
+	Name  string
+	Value uint64
+	Err   error
+}
+
+func (e *ErrorSetRlimit) Error() string {
+	return fmt.Sprintf("failed to set %s limit to %d: %v", e.Name, e.Value, e.Err)
+}
+
+func (e *ErrorSetRlimit) Unwrap() error {
+	return e.Err
+}
+
+// ErrorReadTemplate is returned when a template file cannot be read
+type ErrorReadTemplate struct {
+	Path string
+	Err  error
+}
+
+func (e *ErrorReadTemplate) Error() string {
+	return fmt.Sprintf("failed to read template file '%s': %v", e.Path, e.Err)
+}
+
+func (e *ErrorReadTemplate) Unwrap() error {
+	return e.Err
+}
+
+// ErrorParseTemplate is returned when a template file is not a valid template
+type ErrorParseTemplate struct {
+	Path string
+	Err  error
+}
+
+func (e *ErrorParseTemplate) Error() string {
+	return fmt.Sprintf("failed to parse template '%s': %v", e.Path, e.Err)
+}
+
+func (e *ErrorParseTemplate) Unwrap() error {
+	return e.Err
+}
+
+// ErrorExecuteTemplate is returned when rendering a parsed template fails
+type ErrorExecuteTemplate struct {
+	Path string
+	Err  error
+}
+
+func (e *ErrorExecuteTemplate) Error() string {
+	return fmt.Sprintf("failed to execute template '%s': %v", e.Path, e.Err)
+}
+
+func (e *ErrorExecuteTemplate) Unwrap() error {
+	return e.Err
+}
+
+// ErrorLookupOwner is returned when the owner or group of an output cannot be resolved
+type ErrorLookupOwner struct {
+	Name string
+	Err  error
+}
+
+func (e *ErrorLookupOwner) Error() string {
+	return fmt.Sprintf("failed to look up '%s': %v", e.Name, e.Err)
+}
+
+func (e *ErrorLookupOwner) Unwrap() error {
+	return e.Err
+}
+
+// ErrorListen is returned when an HTTP listener cannot be started
+type ErrorListen struct {
+	Address string
+	Err     error
+}
+
+func (e *ErrorListen) Error() string {
+	return fmt.Sprintf("failed to listen on %s: %v", e.Address, e.Err)
+}
+
+func (e *ErrorListen) Unwrap() error {
+	return e.Err
+}
+
+// ErrorProbe is returned when a probe of the managed process fails
+type ErrorProbe struct {
+	Probe string // Command, URL or address checked
+	Err   error
+}
+
+func (e *ErrorProbe) Error() string {
+	return fmt.Sprintf("probe %s failed: %v", e.Probe, e.Err)
+}
+
+func (e *ErrorProbe) Unwrap() error {
+	return e.Err
+}
+
+// ErrorNoProcess is returned when there is no managed process to act on
+type ErrorNoProcess struct{}
+
+func (e *ErrorNoProcess) Error() string {
+	return "no managed process is running"
+}
+
+// ErrorUnknownCommand is returned when the control socket receives a command
+// it does not know
+type ErrorUnknownCommand struct {
+	Command string
+}
+
+func (e *ErrorUnknownCommand) Error() string {
+	return fmt.Sprintf("unknown command '%s'", e.Command)
+}
+
+// ErrorUnknownOutput is returned when a command names an output that is not
+// generated
+type ErrorUnknownOutput struct {
+	Path string
+}
+
+func (e *ErrorUnknownOutput) Error() string {
+	return fmt.Sprintf("no output is generated at '%s'", e.Path)
+}
+
+// ErrorNotWatching is returned when a command needs the watcher, which is not
+// running
+type ErrorNotWatching struct{}
+
+func (e *ErrorNotWatching) Error() string {
+	return "not watching for changes"
+}
+
+// ErrorControl is returned when a command sent to the control socket fails
+type ErrorControl struct {
+	Socket string
+	Err    error
+}
+
+func (e *ErrorControl) Error() string {
+	return fmt.Sprintf("control socket %s: %v", e.Socket, e.Err)
+}
+
+func (e *ErrorControl) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHook is returned when a hook fails
+type ErrorHook struct {
+	Hook string // Command or URL run
+	Err  error
+}
+
+func (e *ErrorHook) Error() string {
+	return fmt.Sprintf("hook %s failed: %v", e.Hook, e.Err)
+}
+
+func (e *ErrorHook) Unwrap() error {
+	return e.Err
+}
+
+// ErrorOpenOutputFile is returned when the file capturing the output of the
+// managed process cannot be opened
+type ErrorOpenOutputFile struct {
+	Path string
+	Err  error
+}
+
+func (e *ErrorOpenOutputFile) Error() string {
+	return fmt.Sprintf("failed to open process output file '%s': %v", e.Path, e.Err)
+}
+
+func (e *ErrorOpenOutputFile) Unwrap() error {
+	return e.Err
+}
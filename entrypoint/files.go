@@ -2,41 +2,160 @@ package entrypoint
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"html/template"
-	"log"
+	"io"
+	"log/slog"
+	"maps"
 	"os"
+	"os/user"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/OpenSourcererPrime/shoehorn/config"
 )
 
-func (ep *EntryPoint) generateAllFiles() {
+const (
+	defaultFileMode os.FileMode = 0o644
+	defaultDirMode  os.FileMode = 0o755
+)
+
+// GenerateOutputs generates every output once, recording the result of each
+// for the health and metrics endpoints. Outputs that fail are generated again
+// once their inputs change.
+func (ep *EntryPoint) GenerateOutputs() error {
+	var errs []error
 	for _, gen := range ep.appConfig.Generate {
-		generateFile(gen)
+		errs = append(errs, ep.generateOutput(gen, nil))
+	}
+	return errors.Join(errs...)
+}
+
+// GenerateAll renders and writes every output in appConfig once
+func GenerateAll(appConfig *config.Config) error {
+	var errs []error
+	for _, gen := range appConfig.Generate {
+		errs = append(errs, generateFile(gen))
+	}
+	return errors.Join(errs...)
+}
+
+// GenerateAllUnder renders and writes every output in appConfig once, placing
+// each beneath root instead of its configured path. Ownership is not changed
+// so this can be used without privileges, e.g. to compare against golden files.
+func GenerateAllUnder(appConfig *config.Config, root string) error {
+	var errs []error
+	for _, gen := range appConfig.Generate {
+		gen.Path = filepath.Join(root, gen.Path)
+		gen.Owner, gen.Group = "", ""
+		errs = append(errs, generateFile(gen))
+	}
+	return errors.Join(errs...)
+}
+
+// RenderAllTo renders every output in appConfig to w, each preceded by a
+// header line with the path it would be written to
+func RenderAllTo(appConfig *config.Config, w io.Writer) error {
+	var errs []error
+	for _, gen := range appConfig.Generate {
+		outputs, err := RenderOutputs(gen)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, outputPath := range slices.Sorted(maps.Keys(outputs)) {
+			fmt.Fprintf(w, "==> %s <==\n", outputPath)
+			w.Write(outputs[outputPath])
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RenderOutputs renders every file generated for gen without writing them,
+// keyed by the path they would be written to
+func RenderOutputs(gen config.GenerateConfig) (map[string][]byte, error) {
+	if gen.Strategy == "directory" {
+		return renderDirectory(gen)
 	}
+
+	data, err := RenderFile(gen)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{OutputPath(gen): data}, nil
 }
 
-func generateFile(gen config.GenerateConfig) {
+// outputOutdated reports whether rendering gen now would change any file it
+// generates. Outputs that fail to render are not outdated, as regenerating
+// them would fail too.
+func outputOutdated(gen config.GenerateConfig) bool {
+	outputs, err := RenderOutputs(gen)
+	if err != nil {
+		return false
+	}
+	if len(StaleOutputs(gen, outputs)) > 0 {
+		return true
+	}
+	for outputPath, rendered := range outputs {
+		current, err := os.ReadFile(outputPath)
+		if err != nil || !bytes.Equal(current, rendered) {
+			return true
+		}
+	}
+	return false
+}
+
+// OutputPath returns the path of the file generated for gen, or of the
+// directory generated when using the directory strategy
+func OutputPath(gen config.GenerateConfig) string {
+	return filepath.Join(gen.Path, gen.Name)
+}
+
+func generateFile(gen config.GenerateConfig) error {
+	if gen.Strategy == "directory" {
+		return generateDirectory(gen)
+	}
+
+	outputPath := OutputPath(gen)
+
+	data, err := RenderFile(gen)
+	if err != nil {
+		slog.Error("Failed to render output", "name", gen.Name, "output", outputPath, "strategy", gen.Strategy, "error", err)
+		return err
+	}
+
 	// Ensure output directory exists
-	outputDir := filepath.Dir(filepath.Join(gen.Path, gen.Name))
-	err := os.MkdirAll(outputDir, 0o755)
+	outputDir := filepath.Dir(outputPath)
+	err = makeDirs(outputDir, gen.DirMode.OrDefault(defaultDirMode))
 	if err != nil {
-		log.Printf("Failed to create output directory %s: %v", outputDir, err)
-		return
+		slog.Error("Failed to create output directory", "name", gen.Name, "output", outputPath, "path", outputDir, "error", err)
+		return err
 	}
 
-	outputPath := filepath.Join(gen.Path, gen.Name)
+	warnLooserMode(gen)
 
+	err = writeOutput(gen, outputPath, data)
+	if err != nil {
+		slog.Error("Failed to write output file", "name", gen.Name, "output", outputPath, "error", err)
+		return err
+	}
+
+	slog.Info("Generated output", "name", gen.Name, "output", outputPath, "strategy", gen.Strategy)
+	return nil
+}
+
+// RenderFile renders the content of the output described by gen without
+// writing it. Unreadable inputs are logged and skipped.
+func RenderFile(gen config.GenerateConfig) ([]byte, error) {
 	switch gen.Strategy {
 	case "append":
-		// Read and concatenate all input files
+		// Read and concatenate all input files, expanding globs and
+		// directories in sorted order
 		var buffer bytes.Buffer
-		for _, input := range gen.Inputs {
-			data, err := os.ReadFile(input.Path)
-			if err != nil {
-				log.Printf("Failed to read input file %s: %v", input.Path, err)
-				continue
-			}
+		write := func(data []byte) {
 			buffer.Write(data)
 			// Add newline if not present at the end of the file
 			if len(data) > 0 && data[len(data)-1] != '\n' {
@@ -44,52 +163,264 @@ func generateFile(gen config.GenerateConfig) {
 			}
 		}
 
-		err = os.WriteFile(outputPath, buffer.Bytes(), 0o644)
+		for _, input := range gen.Inputs {
+			if input.Env != "" {
+				write([]byte(readEnvInput(gen, input)))
+				continue
+			}
+
+			paths := []string{input.Path}
+			if isMultiInput(input.Path) {
+				paths, _ = expandInput(input.Path)
+			}
+
+			for _, path := range paths {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					slog.Error("Failed to read input file", "name", gen.Name, "output", OutputPath(gen), "input", path, "error", err)
+					continue
+				}
+				write(data)
+			}
+		}
+		return buffer.Bytes(), nil
+
+	case "template":
+		tmpl, err := parseTemplate(gen)
+		if err != nil {
+			return nil, err
+		}
+
+		context := templateContext(gen)
+
+		var buffer bytes.Buffer
+		err = tmpl.Execute(&buffer, context)
 		if err != nil {
-			log.Printf("Failed to write output file %s: %v", outputPath, err)
+			return nil, &ErrorExecuteTemplate{Path: gen.Template, Err: err}
+		}
+		return buffer.Bytes(), nil
+	}
+
+	return nil, &config.ErrorInvalidStrategy{Strategy: gen.Strategy, Name: gen.Name}
+}
+
+// templateContext reads the inputs of gen into the data passed to templates.
+// Globs and directories are a map of file name to content. The environment
+// of shoehorn is available as Env, unless an input has that name.
+func templateContext(gen config.GenerateConfig) map[string]interface{} {
+	context := make(map[string]interface{})
+	context["Env"] = environ()
+	for _, input := range gen.Inputs {
+		if input.Env != "" {
+			context[input.Name] = readEnvInput(gen, input)
+			continue
+		}
+		if isMultiInput(input.Path) {
+			context[input.Name] = readMultiInput(input.Path)
+			continue
+		}
+
+		data, err := os.ReadFile(input.Path)
+		if err != nil {
+			slog.Error("Failed to read input file", "name", gen.Name, "output", OutputPath(gen), "input", input.Path, "error", err)
+			context[input.Name] = "" // Set empty content if file can't be read
 		} else {
-			log.Printf("Successfully generated %s (append strategy)", outputPath)
+			context[input.Name] = string(data)
 		}
+	}
+	return context
+}
 
-	case "template":
-		// Read the template file
-		templateData, err := os.ReadFile(gen.Template)
+// readEnvInput returns the value of the environment variable of input, or an
+// empty string if it is not set
+func readEnvInput(gen config.GenerateConfig, input config.InputFile) string {
+	value, ok := os.LookupEnv(input.Env)
+	if !ok {
+		slog.Error("Environment variable of input is not set", "name", gen.Name, "output", OutputPath(gen), "env", input.Env)
+	}
+	return value
+}
+
+// environ returns the environment of shoehorn as a map of name to value
+func environ() map[string]string {
+	env := make(map[string]string)
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		env[name] = value
+	}
+	return env
+}
+
+func readMultiInput(path string) map[string]string {
+	files, keys := expandInput(path)
+	contents := make(map[string]string, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
 		if err != nil {
-			log.Printf("Failed to read template file %s: %v", gen.Template, err)
-			return
+			slog.Error("Failed to read input file", "input", file, "error", err)
+			continue
 		}
+		contents[keys[file]] = string(data)
+	}
+	return contents
+}
 
-		// Create a template context with input files
-		context := make(map[string]string)
-		for _, input := range gen.Inputs {
-			data, err := os.ReadFile(input.Path)
-			if err != nil {
-				log.Printf("Failed to read input file %s: %v", input.Path, err)
-				context[input.Name] = "" // Set empty content if file can't be read
-			} else {
-				context[input.Name] = string(data)
-			}
+// ValidateTemplates checks that every template referenced by appConfig can be
+// read and parsed
+func ValidateTemplates(appConfig *config.Config) error {
+	var errs []error
+	for _, gen := range appConfig.Generate {
+		switch gen.Strategy {
+		case "template":
+			_, err := parseTemplate(gen)
+			errs = append(errs, err)
+		case "directory":
+			_, err := parseDirectoryTemplates(gen)
+			errs = append(errs, err)
 		}
+	}
+	return errors.Join(errs...)
+}
 
-		// Process the template
-		tmpl, err := template.New("output").Parse(string(templateData))
+func parseTemplate(gen config.GenerateConfig) (*template.Template, error) {
+	templateData, err := os.ReadFile(gen.Template)
+	if err != nil {
+		return nil, &ErrorReadTemplate{Path: gen.Template, Err: err}
+	}
+
+	tmpl, err := template.New("output").Parse(string(templateData))
+	if err != nil {
+		return nil, &ErrorParseTemplate{Path: gen.Template, Err: err}
+	}
+	return tmpl, nil
+}
+
+// writeOutput writes data to outputPath with the configured mode and
+// ownership. The data is written to a temporary file that only gets the final
+// mode and owner and is then renamed over outputPath, so the data is never
+// readable with the mode of a previous file, and readers never see a partly
+// written file.
+func writeOutput(gen config.GenerateConfig, outputPath string, data []byte) error {
+	mode := gen.Mode.OrDefault(defaultFileMode)
+	uid, gid, err := lookupOwner(gen.Owner, gen.Group)
+	if err != nil {
+		return err
+	}
+
+	// CreateTemp creates the file with mode 0600
+	file, err := os.CreateTemp(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tempPath := file.Name()
+
+	err = writeTemp(file, data, mode, uid, gid)
+	if err == nil {
+		err = os.Rename(tempPath, outputPath)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// writeTemp writes data to file, sets its mode and owner and closes it
+func writeTemp(file *os.File, data []byte, mode os.FileMode, uid, gid int) error {
+	_, err := file.Write(data)
+	if err == nil && (uid != -1 || gid != -1) {
+		err = file.Chown(uid, gid)
+	}
+	if err == nil {
+		// After chown, which may clear the setuid and setgid bits
+		err = file.Chmod(mode)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// makeDirs creates dir and any missing parents with mode. Unlike
+// os.MkdirAll the mode of created directories is not reduced by the umask.
+// Existing directories are left unchanged.
+func makeDirs(dir string, mode os.FileMode) error {
+	var missing []string
+	for path := filepath.Clean(dir); ; path = filepath.Dir(path) {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		missing = append(missing, path)
+		if filepath.Dir(path) == path {
+			break
+		}
+	}
+
+	err := os.MkdirAll(dir, mode)
+	if err != nil {
+		return err
+	}
+	for _, path := range missing {
+		err = os.Chmod(path, mode)
 		if err != nil {
-			log.Printf("Failed to parse template %s: %v", gen.Template, err)
-			return
+			return err
 		}
+	}
+	return nil
+}
 
-		var buffer bytes.Buffer
-		err = tmpl.Execute(&buffer, context)
+// lookupOwner resolves user and group names or numeric ids, returning -1 for
+// any that are not set so os.Chown leaves them unchanged
+func lookupOwner(owner, group string) (int, int, error) {
+	uid, gid := -1, -1
+
+	if owner != "" {
+		id, err := strconv.Atoi(owner)
 		if err != nil {
-			log.Printf("Failed to execute template for %s: %v", outputPath, err)
-			return
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return -1, -1, &ErrorLookupOwner{Name: owner, Err: err}
+			}
+			id, _ = strconv.Atoi(u.Uid)
 		}
+		uid = id
+	}
 
-		err = os.WriteFile(outputPath, buffer.Bytes(), 0o644)
+	if group != "" {
+		id, err := strconv.Atoi(group)
 		if err != nil {
-			log.Printf("Failed to write output file %s: %v", outputPath, err)
-		} else {
-			log.Printf("Successfully generated %s (template strategy)", outputPath)
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return -1, -1, &ErrorLookupOwner{Name: group, Err: err}
+			}
+			id, _ = strconv.Atoi(g.Gid)
+		}
+		gid = id
+	}
+
+	return uid, gid, nil
+}
+
+// warnLooserMode logs a warning for every input that is more restrictive than
+// the output it is rendered into, e.g. a 0600 secret ending up in a 0644 file
+func warnLooserMode(gen config.GenerateConfig) {
+	mode := gen.Mode.OrDefault(defaultFileMode)
+	for _, input := range gen.Inputs {
+		if input.Env != "" {
+			continue
+		}
+		info, err := os.Stat(input.Path)
+		if err != nil {
+			continue
+		}
+		if mode.Perm()&^info.Mode().Perm() != 0 {
+			slog.Warn("Output is more permissive than its input",
+				"name", gen.Name, "output", OutputPath(gen), "mode", fmt.Sprintf("%04o", mode.Perm()),
+				"input", input.Path, "input_mode", fmt.Sprintf("%04o", info.Mode().Perm()))
 		}
 	}
 }
@@ -0,0 +1,124 @@
+package entrypoint
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WatchForChanges records a heartbeat every heartbeatInterval. shoehorn is
+// not healthy once none was recorded for heartbeatTimeout, as the watch loop
+// is stuck.
+const (
+	heartbeatInterval = 5 * time.Second
+	heartbeatTimeout  = time.Minute
+)
+
+// outputResult is the result of the last generation of an output
+type outputResult struct {
+	err  error
+	time time.Time
+}
+
+// recordOutputResult records whether generating an output succeeded, for
+// readiness
+func (ep *EntryPoint) recordOutputResult(outputPath string, err error) {
+	ep.statusLock.Lock()
+	defer ep.statusLock.Unlock()
+	if ep.outputResults == nil {
+		ep.outputResults = make(map[string]outputResult)
+	}
+	ep.outputResults[outputPath] = outputResult{err: err, time: time.Now()}
+}
+
+// processRunning reports whether the managed process has been started and
+// has not exited. The process lock must be held.
+func (ep *EntryPoint) processRunning() bool {
+	if ep.managedCmd == nil || ep.managedCmd.Process == nil {
+		return false
+	}
+	select {
+	case <-ep.managedDone:
+		return false
+	default:
+		return true
+	}
+}
+
+// notReadyReasons returns why shoehorn is not ready, or nothing if every
+// output has been generated, the managed process is running and the
+// readiness probe passes
+func (ep *EntryPoint) notReadyReasons() []string {
+	ep.processLock.Lock()
+	generate := ep.appConfig.Generate
+	processPath := ep.appConfig.Process.Path
+	running := ep.processRunning()
+	probe := ep.appConfig.Health.ReadinessProbe
+	ep.processLock.Unlock()
+
+	var reasons []string
+	ep.statusLock.Lock()
+	for _, gen := range generate {
+		outputPath := OutputPath(gen)
+		result, generated := ep.outputResults[outputPath]
+		switch {
+		case !generated:
+			reasons = append(reasons, fmt.Sprintf("output %s has not been generated", outputPath))
+		case result.err != nil:
+			reasons = append(reasons, fmt.Sprintf("output %s failed to generate: %v", outputPath, result.err))
+		}
+	}
+	healthCheckErr := ep.healthCheckErr
+	ep.statusLock.Unlock()
+
+	if healthCheckErr != nil {
+		reasons = append(reasons, fmt.Sprintf("health check %v", healthCheckErr))
+	}
+	if processPath != "" && !running {
+		reasons = append(reasons, "managed process is not running")
+	}
+
+	// The probe is only meaningful once the process is running
+	if probe != nil && len(reasons) == 0 {
+		if err := runProbe(probe); err != nil {
+			reasons = append(reasons, fmt.Sprintf("readiness %v", err))
+		}
+	}
+	return reasons
+}
+
+// notHealthyReasons returns why shoehorn is not healthy, or nothing if it is
+// still supervising its outputs
+func (ep *EntryPoint) notHealthyReasons() []string {
+	var reasons []string
+	if ep.watchStopped.Load() {
+		reasons = append(reasons, "no longer watching for changes")
+	} else if heartbeat := ep.heartbeat.Load(); heartbeat != 0 {
+		// Before WatchForChanges started there is no heartbeat to miss
+		if since := time.Since(time.Unix(0, heartbeat)); since > heartbeatTimeout {
+			reasons = append(reasons, fmt.Sprintf("watching for changes is stuck, last heartbeat %s ago", since.Round(time.Second)))
+		}
+	}
+	return reasons
+}
+
+func (ep *EntryPoint) handleHealthz(w http.ResponseWriter, req *http.Request) {
+	writeHealth(w, ep.notHealthyReasons())
+}
+
+func (ep *EntryPoint) handleReadyz(w http.ResponseWriter, req *http.Request) {
+	writeHealth(w, ep.notReadyReasons())
+}
+
+// writeHealth responds with 200 and "ok", or with 503 and each reason on its
+// own line
+func writeHealth(w http.ResponseWriter, reasons []string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(reasons) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, strings.Join(reasons, "\n"))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
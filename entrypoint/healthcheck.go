@@ -0,0 +1,90 @@
+package entrypoint
+
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckRetries  = 3
+)
+
+// runHealthChecks probes the managed process with process.healthCheck until
+// Close is called. After retries consecutive failures the process is
+// restarted, or shoehorn is marked not ready until a probe passes.
+func (ep *EntryPoint) runHealthChecks() {
+	failures := 0
+	for {
+		ep.processLock.Lock()
+		healthCheck := ep.appConfig.Process.HealthCheck
+		running := ep.processRunning()
+		started := ep.processStarted
+		ep.processLock.Unlock()
+
+		interval := defaultHealthCheckInterval
+		if healthCheck != nil && healthCheck.Interval > 0 {
+			interval = healthCheck.Interval
+		}
+		select {
+		case <-ep.closed:
+			return
+		case <-time.After(interval):
+		}
+
+		if healthCheck == nil || !running {
+			failures = 0
+			ep.setHealthCheckError(nil)
+			continue
+		}
+
+		err := runProbe(&healthCheck.ProbeConfig)
+		if err == nil {
+			if failures > 0 {
+				slog.Info("Health check of managed process passed", "failures", failures)
+			}
+			failures = 0
+			ep.setHealthCheckError(nil)
+			continue
+		}
+
+		ep.metrics.healthCheckFailures.Inc()
+		if time.Since(started) < healthCheck.StartPeriod {
+			slog.Warn("Health check of managed process failed during its start period", "error", err)
+			continue
+		}
+
+		failures++
+		retries := healthCheck.Retries
+		if retries == 0 {
+			retries = defaultHealthCheckRetries
+		}
+		slog.Warn("Health check of managed process failed", "failures", failures, "retries", retries, "error", err)
+		if failures < retries {
+			continue
+		}
+		failures = 0
+
+		if healthCheck.OnFailure == "unready" {
+			slog.Error("Managed process is unhealthy, marking shoehorn not ready")
+			ep.setHealthCheckError(err)
+			continue
+		}
+
+		slog.Error("Managed process is unhealthy, restarting it")
+		ep.processLock.Lock()
+		err = ep.restartManagedProcess()
+		ep.processLock.Unlock()
+		if err != nil {
+			slog.Error("Failed to restart managed process", "error", err)
+		}
+	}
+}
+
+// setHealthCheckError records the failure that made shoehorn not ready, or
+// clears it when err is nil
+func (ep *EntryPoint) setHealthCheckError(err error) {
+	ep.statusLock.Lock()
+	defer ep.statusLock.Unlock()
+	ep.healthCheckErr = err
+}
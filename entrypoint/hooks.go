@@ -0,0 +1,130 @@
+package entrypoint
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenSourcererPrime/shoehorn/config"
+)
+
+const defaultHookTimeout = 10 * time.Second
+
+// hookEvent is the JSON description of an event passed to hooks
+type hookEvent struct {
+	Event    string            `json:"event"`
+	Time     time.Time         `json:"time"`
+	Output   string            `json:"output,omitempty"`
+	Inputs   []string          `json:"inputs,omitempty"` // Changed inputs that caused the output to be generated
+	Hashes   map[string]string `json:"hashes,omitempty"` // SHA-256 of every generated file
+	Method   string            `json:"method,omitempty"` // How the process was reloaded
+	PID      int               `json:"pid,omitempty"`
+	ExitCode *int              `json:"exitCode,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// runHooks runs every hook with event in the background, logging the ones
+// that fail. The returned WaitGroup is done once they all finished.
+func (ep *EntryPoint) runHooks(name string, hooks []config.HookConfig, event hookEvent) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	if len(hooks) == 0 {
+		return &wg
+	}
+
+	event.Event = name
+	event.Time = time.Now()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Failed to encode hook event", "event", name, "error", err)
+		return &wg
+	}
+
+	for _, hook := range hooks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := runHook(hook, name, payload)
+			if err != nil {
+				slog.Warn("Hook failed", "event", name, "error", err)
+				ep.metrics.hookFailures.Inc(name)
+			}
+		}()
+	}
+	return &wg
+}
+
+// runHook runs the command of hook with payload on its stdin, or POSTs
+// payload to its URL
+func runHook(hook config.HookConfig, name string, payload []byte) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if len(hook.Exec) > 0 {
+		c := exec.CommandContext(ctx, hook.Exec[0], hook.Exec[1:]...)
+		c.Env = append(os.Environ(), "SHOEHORN_EVENT="+name)
+		c.Stdin = bytes.NewReader(payload)
+		// Do not wait for children of the command holding its output open
+		c.WaitDelay = timeout
+		output, err := c.CombinedOutput()
+		if err != nil {
+			if message := strings.TrimSpace(string(output)); message != "" {
+				err = fmt.Errorf("%w: %s", err, message)
+			}
+			return &ErrorHook{Hook: strings.Join(hook.Exec, " "), Err: err}
+		}
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.HTTP, bytes.NewReader(payload))
+	if err != nil {
+		return &ErrorHook{Hook: hook.HTTP, Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Shoehorn-Event", name)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return &ErrorHook{Hook: hook.HTTP, Err: err}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &ErrorHook{Hook: hook.HTTP, Err: fmt.Errorf("status %s", resp.Status)}
+	}
+	return nil
+}
+
+// outputHashes returns the SHA-256 of every file generated for gen, keyed by
+// its path
+func outputHashes(gen config.GenerateConfig) map[string]string {
+	outputPath := OutputPath(gen)
+	paths := []string{outputPath}
+	if gen.Strategy == "directory" {
+		paths, _ = generatedFiles(gen)
+	}
+
+	hashes := make(map[string]string, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		hashes[path] = hex.EncodeToString(sum[:])
+	}
+	return hashes
+}
@@ -0,0 +1,50 @@
+package entrypoint
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+// Serve serves the metrics on metrics.listen and the health endpoints on
+// health.listen until Close is called. Both are served by one listener when
+// the addresses are the same, and neither is served when unset.
+func (ep *EntryPoint) Serve() error {
+	muxes := make(map[string]*http.ServeMux)
+	var addresses []string
+	mux := func(address string) *http.ServeMux {
+		if muxes[address] == nil {
+			muxes[address] = http.NewServeMux()
+			addresses = append(addresses, address)
+		}
+		return muxes[address]
+	}
+
+	if listen := ep.appConfig.Metrics.Listen; listen != "" {
+		mux(listen).Handle("/metrics", ep.metrics.registry)
+	}
+	if listen := ep.appConfig.Health.Listen; listen != "" {
+		mux(listen).HandleFunc("/healthz", ep.handleHealthz)
+		mux(listen).HandleFunc("/readyz", ep.handleReadyz)
+	}
+
+	for _, address := range addresses {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return &ErrorListen{Address: address, Err: err}
+		}
+
+		server := &http.Server{Handler: muxes[address]}
+		ep.servers = append(ep.servers, server)
+
+		slog.Info("Serving HTTP endpoints", "address", listener.Addr().String())
+		go func() {
+			err := server.Serve(listener)
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("HTTP server failed", "address", address, "error", err)
+			}
+		}()
+	}
+	return nil
+}
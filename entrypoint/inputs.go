@@ -0,0 +1,154 @@
+package entrypoint
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/OpenSourcererPrime/shoehorn/config"
+	"github.com/fsnotify/fsnotify"
+)
+
+// isMultiInput reports whether the input path is a glob or a directory and
+// so may refer to any number of files
+func isMultiInput(path string) bool {
+	if isGlob(path) {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// expandInput returns the files a glob or directory input refers to in sorted
+// order, keyed by their path relative to the directory the input is based on.
+// Only regular files are included, and hidden files are skipped in
+// directories, e.g. the ..data entries of a Kubernetes volume.
+func expandInput(path string) ([]string, map[string]string) {
+	var matches []string
+	baseDir := path
+
+	if isGlob(path) {
+		matches, _ = filepath.Glob(path)
+		baseDir = globBase(path)
+	} else {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, nil
+		}
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), ".") {
+				matches = append(matches, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(matches)
+
+	var files []string
+	keys := make(map[string]string)
+	for _, match := range matches {
+		// Stat follows symlinks, which is how mounted volumes expose files
+		info, err := os.Stat(match)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		key, err := filepath.Rel(baseDir, match)
+		if err != nil {
+			key = filepath.Base(match)
+		}
+		files = append(files, match)
+		keys[match] = key
+	}
+	return files, keys
+}
+
+// globBase returns the longest leading directory of a glob without any
+// pattern characters
+func globBase(pattern string) string {
+	dir := filepath.Dir(pattern)
+	for isGlob(dir) {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// inputWatchTargets returns the paths to watch for an input. For a glob these
+// are the directories that may contain matches, so added files are noticed.
+func inputWatchTargets(path string) []string {
+	if !isGlob(path) {
+		return []string{path}
+	}
+
+	dirPattern := filepath.Dir(path)
+	if !isGlob(dirPattern) {
+		return []string{dirPattern}
+	}
+
+	matches, _ := filepath.Glob(dirPattern)
+	var dirs []string
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.IsDir() {
+			dirs = append(dirs, match)
+		}
+	}
+	return dirs
+}
+
+// inputsMissing reports whether gen has inputs but none of them exist, so
+// its output was generated from nothing. An environment variable is missing
+// when it is unset, and a glob or directory when it matches no files.
+func inputsMissing(gen config.GenerateConfig) bool {
+	for _, input := range gen.Inputs {
+		switch {
+		case input.Env != "":
+			if _, ok := os.LookupEnv(input.Env); ok {
+				return false
+			}
+		case isMultiInput(input.Path):
+			if files, _ := expandInput(input.Path); len(files) > 0 {
+				return false
+			}
+		default:
+			if _, err := os.Stat(input.Path); err == nil {
+				return false
+			}
+		}
+	}
+	return len(gen.Inputs) > 0
+}
+
+// affectedBy reports whether the operation op on the file name requires gen
+// to be regenerated. A single file counts as changed when it is written, but
+// also when it is created or replaced, which is all a poll may see.
+func affectedBy(gen config.GenerateConfig, name string, op fsnotify.Op) bool {
+	fileChanged := op.Has(fsnotify.Write) || op.Has(fsnotify.Create) || op.Has(fsnotify.Rename)
+	for _, input := range gen.Inputs {
+		if isMultiInput(input.Path) {
+			// Any change in a watched directory may add, remove or modify
+			// one of the expanded files
+			for _, dir := range inputWatchTargets(input.Path) {
+				if filepath.Dir(name) == filepath.Clean(dir) {
+					return true
+				}
+			}
+		} else if input.Path == name && fileChanged {
+			return true
+		}
+	}
+
+	// Any change in the source tree of the directory strategy
+	if gen.Strategy == "directory" {
+		for _, dir := range sourceDirs(gen) {
+			if filepath.Dir(name) == dir || name == dir {
+				return true
+			}
+		}
+	}
+
+	// Check if it's the template file
+	return gen.Strategy == "template" && gen.Template == name && fileChanged
+}
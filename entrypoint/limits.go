@@ -0,0 +1,158 @@
+package entrypoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/OpenSourcererPrime/shoehorn/config"
+	"golang.org/x/sys/unix"
+)
+
+// LimitsEnv passes the umask and resource limits of a managed process to the
+// copy of shoehorn that applies them before executing it, see ExecWithLimits
+const LimitsEnv = "SHOEHORN_EXEC_LIMITS"
+
+// childLimits are the umask and resource limits applied to a managed process
+type childLimits struct {
+	Path    string        `json:"path"`            // Executable run once the limits are applied
+	Umask   *int          `json:"umask,omitempty"` // Inherited when unset
+	Rlimits []childRlimit `json:"rlimits,omitempty"`
+	ErrFD   int           `json:"errFd"` // Reports why the limits could not be applied
+}
+
+type childRlimit struct {
+	Name     string `json:"name"`
+	Resource int    `json:"resource"`
+	Value    uint64 `json:"value"`
+}
+
+// ExecWithLimits applies the limits encoded in value, the content of
+// LimitsEnv, to the current process and replaces it with the managed process.
+//
+// The umask and resource limits are shared by every thread of a process, so
+// they cannot be changed in shoehorn for a single child without affecting
+// everything else it does. A managed process with limits is started through a
+// copy of the running executable instead, which must call ExecWithLimits
+// before doing anything else when LimitsEnv is set. It only returns when the
+// process could not be executed, after reporting why to the shoehorn that
+// started it.
+func ExecWithLimits(value string) error {
+	os.Unsetenv(LimitsEnv)
+
+	var limits childLimits
+	err := json.Unmarshal([]byte(value), &limits)
+	if err == nil {
+		err = execWithLimits(limits)
+	}
+
+	errFile := os.Stderr
+	if limits.ErrFD > 0 {
+		errFile = os.NewFile(uintptr(limits.ErrFD), "limits")
+	}
+	fmt.Fprint(errFile, err)
+	return err
+}
+
+// execWithLimits applies limits to the current process and replaces it with
+// limits.Path, only returning when that fails
+func execWithLimits(limits childLimits) error {
+	if limits.Umask != nil {
+		syscall.Umask(*limits.Umask)
+	}
+	for _, limit := range limits.Rlimits {
+		// syscall.Setrlimit stops the raised open file limit of the Go
+		// runtime from being restored on exec
+		err := syscall.Setrlimit(limit.Resource, &syscall.Rlimit{Cur: limit.Value, Max: limit.Value})
+		if err != nil {
+			return &ErrorSetRlimit{Name: limit.Name, Value: limit.Value, Err: err}
+		}
+	}
+
+	syscall.CloseOnExec(limits.ErrFD)
+	return syscall.Exec(limits.Path, os.Args, os.Environ())
+}
+
+// startWithLimits starts the command with the configured umask and resource
+// limits. They are applied by ExecWithLimits in a copy of the running
+// executable before it executes the process, so shoehorn itself is unaffected.
+func startWithLimits(c *exec.Cmd, processConfig config.ProcessConfig) error {
+	limits := childLimits{Rlimits: rlimits(processConfig.Rlimits)}
+	if processConfig.Umask != nil {
+		umask := int(*processConfig.Umask)
+		limits.Umask = &umask
+	}
+	if limits.Umask == nil && len(limits.Rlimits) == 0 {
+		return c.Start()
+	}
+	if c.Err != nil {
+		return c.Err
+	}
+
+	errReader, errWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer errReader.Close()
+
+	limits.Path = c.Path
+	limits.ErrFD = 3 + len(c.ExtraFiles)
+	encoded, err := json.Marshal(limits)
+	if err != nil {
+		errWriter.Close()
+		return err
+	}
+	if c.Env == nil {
+		c.Env = os.Environ()
+	}
+	c.Env = append(c.Env, LimitsEnv+"="+string(encoded))
+	c.ExtraFiles = append(c.ExtraFiles, errWriter)
+	c.Path = "/proc/self/exe"
+
+	err = c.Start()
+	errWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	// The pipe is closed without a message once the process was executed
+	message, _ := io.ReadAll(errReader)
+	if len(message) > 0 {
+		c.Wait()
+		return errors.New(strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// rlimits returns the configured resource limits
+func rlimits(rlimits config.RlimitsConfig) []childRlimit {
+	limits := []struct {
+		name     string
+		resource int
+		value    *config.Rlimit
+	}{
+		{"nofile", unix.RLIMIT_NOFILE, rlimits.Nofile},
+		{"nproc", unix.RLIMIT_NPROC, rlimits.Nproc},
+		{"core", unix.RLIMIT_CORE, rlimits.Core},
+		{"memlock", unix.RLIMIT_MEMLOCK, rlimits.Memlock},
+	}
+
+	var result []childRlimit
+	for _, limit := range limits {
+		if limit.value == nil {
+			continue
+		}
+
+		value := uint64(*limit.value)
+		if *limit.value == config.RlimitUnlimited {
+			value = unix.RLIM_INFINITY
+		}
+		result = append(result, childRlimit{Name: limit.name, Resource: limit.resource, Value: value})
+	}
+	return result
+}
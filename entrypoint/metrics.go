@@ -0,0 +1,131 @@
+package entrypoint
+
+import (
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/OpenSourcererPrime/shoehorn/config"
+	"github.com/OpenSourcererPrime/shoehorn/metrics"
+)
+
+// entryPointMetrics are the metrics exposed on metrics.listen
+type entryPointMetrics struct {
+	registry *metrics.Registry
+
+	generations         *metrics.CounterVec
+	generationFailures  *metrics.CounterVec
+	lastSuccess         *metrics.GaugeVec
+	renderDuration      *metrics.HistogramVec
+	reloads             *metrics.CounterVec
+	restarts            *metrics.CounterVec
+	lastExitCode        *metrics.GaugeVec
+	watcherErrors       *metrics.CounterVec
+	healthCheckFailures *metrics.CounterVec
+	droppedOutputLines  *metrics.CounterVec
+	hookFailures        *metrics.CounterVec
+
+	// Unix time in nanoseconds the managed process started, 0 while it is
+	// not running. The process lock cannot be taken while the metrics are
+	// written, as it is held while waiting for the process to record its exit.
+	processStarted atomic.Int64
+}
+
+func newEntryPointMetrics() *entryPointMetrics {
+	registry := metrics.NewRegistry()
+	started := time.Now()
+
+	m := &entryPointMetrics{
+		registry:            registry,
+		generations:         registry.Counter("shoehorn_generations_total", "Number of times an output was generated", "output"),
+		generationFailures:  registry.Counter("shoehorn_generation_failures_total", "Number of times generating an output failed", "output"),
+		lastSuccess:         registry.Gauge("shoehorn_last_generation_success_timestamp_seconds", "Unix time an output was last generated successfully", "output"),
+		renderDuration:      registry.Histogram("shoehorn_render_duration_seconds", "Time taken to render and write an output", metrics.DefaultBuckets, "output"),
+		reloads:             registry.Counter("shoehorn_reloads_total", "Number of reloads of the managed process", "method", "result"),
+		restarts:            registry.Counter("shoehorn_process_restarts_total", "Number of times the managed process was restarted"),
+		lastExitCode:        registry.Gauge("shoehorn_process_last_exit_code", "Exit code of the last managed process that exited, 128+signal if it was killed"),
+		watcherErrors:       registry.Counter("shoehorn_watcher_errors_total", "Number of errors reported by the file watcher"),
+		healthCheckFailures: registry.Counter("shoehorn_health_check_failures_total", "Number of failed health checks of the managed process"),
+		droppedOutputLines:  registry.Counter("shoehorn_process_output_dropped_lines_total", "Number of lines of process output dropped because they could not be written fast enough"),
+		hookFailures:        registry.Counter("shoehorn_hook_failures_total", "Number of hooks that failed", "event"),
+	}
+	registry.GaugeFunc("shoehorn_uptime_seconds", "Seconds since shoehorn started", func() float64 {
+		return time.Since(started).Seconds()
+	})
+	registry.GaugeFunc("shoehorn_process_uptime_seconds", "Seconds since the managed process started, 0 while it is not running", m.processUptime)
+	return m
+}
+
+// processUptime returns the seconds since the managed process started, or 0
+// while it is not running
+func (m *entryPointMetrics) processUptime() float64 {
+	started := m.processStarted.Load()
+	if started == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, started)).Seconds()
+}
+
+// generateOutput generates gen, recording the outcome in the metrics and
+// running the hooks of the outcome. changedInputs are the inputs whose change
+// caused it to be generated.
+func (ep *EntryPoint) generateOutput(gen config.GenerateConfig, changedInputs []string) error {
+	outputPath := OutputPath(gen)
+
+	start := time.Now()
+	err := generateFile(gen)
+	ep.metrics.renderDuration.Observe(time.Since(start).Seconds(), outputPath)
+
+	// An output generated from nothing is not ready, although generating it
+	// succeeded
+	if err == nil && inputsMissing(gen) {
+		ep.recordOutputResult(outputPath, &ErrorInputsMissing{Output: outputPath})
+	} else {
+		ep.recordOutputResult(outputPath, err)
+	}
+	ep.metrics.generations.Inc(outputPath)
+	if err != nil {
+		ep.metrics.generationFailures.Inc(outputPath)
+		ep.runHooks("onGenerateError", ep.appConfig.Hooks.OnGenerateError, hookEvent{
+			Output: outputPath, Inputs: changedInputs, Error: err.Error(),
+		})
+	} else {
+		ep.metrics.lastSuccess.Set(float64(time.Now().Unix()), outputPath)
+		ep.runHooks("onGenerate", ep.appConfig.Hooks.OnGenerate, hookEvent{
+			Output: outputPath, Inputs: changedInputs, Hashes: outputHashes(gen),
+		})
+	}
+	return err
+}
+
+// recordReload records a reload of the managed process and its result, and
+// runs the reload hooks. The process lock must be held.
+func (ep *EntryPoint) recordReload(method string, err error) {
+	result := "success"
+	event := hookEvent{Method: method, PID: ep.managedCmd.Process.Pid}
+	if err != nil {
+		result = "failure"
+		event.Error = err.Error()
+	}
+	ep.metrics.reloads.Inc(method, result)
+	ep.runHooks("onReload", ep.appConfig.Hooks.OnReload, event)
+}
+
+// recordExit records the exit code of the managed process
+func (ep *EntryPoint) recordExit(c *exec.Cmd) {
+	ep.metrics.processStarted.Store(0)
+	if c.ProcessState == nil {
+		return
+	}
+	ep.metrics.lastExitCode.Set(float64(exitCode(c.ProcessState)))
+}
+
+// exitCode returns the exit code of a process, or 128+signal if it was killed
+func exitCode(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
@@ -0,0 +1,100 @@
+package entrypoint
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchMissing watches the nearest existing parent of path in its place, so
+// the path can be watched once it is created
+func (ep *EntryPoint) watchMissing(path string) {
+	parent := existingParent(path)
+	ep.missing[path] = parent
+
+	if !slices.Contains(ep.watcher.WatchList(), parent) && !slices.Contains(ep.poller.WatchList(), parent) {
+		err := ep.addWatch(parent)
+		if err != nil {
+			slog.Warn("Could not watch parent of missing file", "input", path, "parent", parent, "error", err)
+			return
+		}
+	}
+	slog.Info("Waiting for file to be created", "input", path, "parent", parent)
+}
+
+// updateMissing follows the creation and removal of watched paths, returning
+// the paths that appeared again and are now watched themselves
+func (ep *EntryPoint) updateMissing(event fsnotify.Event) []string {
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Remove) && !event.Has(fsnotify.Rename) {
+		return nil
+	}
+
+	// The inotify watch of a file is lost when it is removed or replaced, so
+	// it is watched again once it exists. Polled paths are followed by the
+	// poller itself.
+	if !event.Has(fsnotify.Create) && watchedPaths(&ep.appConfig)[event.Name] && !slices.Contains(ep.poller.WatchList(), event.Name) {
+		ep.watcher.Remove(event.Name)
+		ep.watchMissing(event.Name)
+	}
+
+	var appeared []string
+	for path, parent := range ep.missing {
+		if _, err := os.Stat(path); err == nil {
+			delete(ep.missing, path)
+			ep.watchPath(path)
+			appeared = append(appeared, path)
+		} else if nearer := existingParent(path); nearer != parent {
+			// A directory on the way to the path was created or removed
+			delete(ep.missing, path)
+			ep.watchMissing(path)
+		} else {
+			continue
+		}
+		ep.unwatchParent(parent)
+	}
+	sort.Strings(appeared)
+	return appeared
+}
+
+// forgetMissing stops waiting for path to be created
+func (ep *EntryPoint) forgetMissing(path string) {
+	parent, ok := ep.missing[path]
+	if !ok {
+		return
+	}
+	delete(ep.missing, path)
+	ep.unwatchParent(parent)
+}
+
+// unwatchParent stops watching a parent of missing paths once it is neither
+// needed for other missing paths nor watched for its own sake
+func (ep *EntryPoint) unwatchParent(parent string) {
+	for _, otherParent := range ep.missing {
+		if otherParent == parent {
+			return
+		}
+	}
+	if watchedPaths(&ep.appConfig)[parent] || ep.configDirs[parent] {
+		return
+	}
+	ep.removeWatch(parent)
+}
+
+// existingParent returns the nearest parent directory of path that exists
+func existingParent(path string) string {
+	parent := filepath.Dir(path)
+	for {
+		if info, err := os.Stat(parent); err == nil && info.IsDir() {
+			return parent
+		}
+		next := filepath.Dir(parent)
+		if next == parent {
+			return parent
+		}
+		parent = next
+	}
+}
@@ -0,0 +1,268 @@
+package entrypoint
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/OpenSourcererPrime/shoehorn/config"
+)
+
+const (
+	defaultOutputMaxSize  = 10 << 20
+	defaultOutputMaxFiles = 3
+
+	// maxOutputLine is the longest line kept whole, longer lines are split
+	maxOutputLine = 64 << 10
+	// outputQueueSize is the number of lines queued before lines are dropped
+	outputQueueSize = 1024
+	// outputFlushTimeout bounds how long an exited process's output is
+	// drained, as descendants may still hold its stdout open
+	outputFlushTimeout = time.Second
+)
+
+// outputLine is a line written by the managed process
+type outputLine struct {
+	stream string // "stdout" or "stderr"
+	text   string
+}
+
+// outputCapture reads the stdout and stderr of the managed process through
+// pipes and writes each line in the configured format. Lines are queued and
+// dropped when the queue is full, so a slow reader never blocks the process.
+type outputCapture struct {
+	config  config.OutputConfig
+	name    string
+	lines   chan outputLine
+	readers sync.WaitGroup
+	done    chan struct{} // Closed once every queued line was written
+	stdout  io.Writer
+	stderr  io.Writer
+	file    *rotatingFile
+	dropped func()
+}
+
+// needsCapture reports whether the output of the process must be read by
+// shoehorn rather than written directly to its stdout and stderr
+func needsCapture(output config.OutputConfig) bool {
+	return (output.Format != "" && output.Format != "passthrough") || output.File != ""
+}
+
+func newOutputCapture(processConfig config.ProcessConfig, dropped func()) (*outputCapture, error) {
+	output := processConfig.Output
+	capture := &outputCapture{
+		config:  output,
+		name:    output.Name,
+		lines:   make(chan outputLine, outputQueueSize),
+		done:    make(chan struct{}),
+		stdout:  os.Stdout,
+		stderr:  os.Stderr,
+		dropped: dropped,
+	}
+	if capture.name == "" {
+		capture.name = filepath.Base(processConfig.Path)
+	}
+
+	if output.File != "" {
+		file, err := openRotatingFile(output.File, output.MaxSize, output.MaxFiles)
+		if err != nil {
+			return nil, &ErrorOpenOutputFile{Path: output.File, Err: err}
+		}
+		capture.file = file
+	}
+	return capture, nil
+}
+
+// pipe returns the write end of a pipe for the process to use as stream.
+// The caller must close it once the process has started.
+func (o *outputCapture) pipe(stream string) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	o.readers.Add(1)
+	go o.read(stream, r)
+	return w, nil
+}
+
+// start writes queued lines until every pipe is closed by the process and
+// any descendants that inherited it
+func (o *outputCapture) start() {
+	go func() {
+		o.readers.Wait()
+		close(o.lines)
+	}()
+
+	go func() {
+		defer close(o.done)
+		for line := range o.lines {
+			o.write(line)
+		}
+		if o.file != nil {
+			o.file.Close()
+		}
+	}()
+}
+
+// wait waits for the queued output to be written, at most for timeout
+func (o *outputCapture) wait(timeout time.Duration) {
+	select {
+	case <-o.done:
+	case <-time.After(timeout):
+	}
+}
+
+func (o *outputCapture) read(stream string, r *os.File) {
+	defer o.readers.Done()
+	defer r.Close()
+
+	reader := bufio.NewReaderSize(r, maxOutputLine)
+	for {
+		// A partial line is only written once it is completed, or once the
+		// pipe is closed
+		line, err := reader.ReadSlice('\n')
+		if len(line) > 0 {
+			if line[len(line)-1] == '\n' {
+				line = line[:len(line)-1]
+			}
+			o.queue(outputLine{stream: stream, text: string(line)})
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return
+		}
+	}
+}
+
+func (o *outputCapture) queue(line outputLine) {
+	select {
+	case o.lines <- line:
+	default:
+		o.dropped()
+	}
+}
+
+func (o *outputCapture) write(line outputLine) {
+	var formatted []byte
+	switch o.config.Format {
+	case "prefix":
+		formatted = fmt.Appendf(nil, "[%s] %s\n", o.name, line.text)
+	case "json":
+		record, _ := json.Marshal(struct {
+			Time    string `json:"time"`
+			Process string `json:"process"`
+			Stream  string `json:"stream"`
+			Message string `json:"message"`
+		}{time.Now().Format(time.RFC3339Nano), o.name, line.stream, line.text})
+		formatted = append(record, '\n')
+	default:
+		formatted = append([]byte(line.text), '\n')
+	}
+
+	console := o.stdout
+	if line.stream == "stderr" {
+		console = o.stderr
+	}
+	console.Write(formatted)
+
+	if o.file != nil {
+		_, err := o.file.Write(formatted)
+		if err != nil {
+			slog.Error("Failed to write process output file", "path", o.config.File, "error", err)
+		}
+	}
+}
+
+// captureOutput connects the stdout and stderr of c to pipes read by a new
+// outputCapture, which must be started once c has started
+func (ep *EntryPoint) captureOutput(c *exec.Cmd) (*outputCapture, error) {
+	capture, err := newOutputCapture(ep.appConfig.Process, func() {
+		ep.metrics.droppedOutputLines.Inc()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := capture.pipe("stdout")
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := capture.pipe("stderr")
+	if err != nil {
+		stdout.Close()
+		return nil, err
+	}
+	c.Stdout, c.Stderr = stdout, stderr
+	return capture, nil
+}
+
+// rotatingFile is a file that is renamed to path.1, path.2 and so on once it
+// reaches maxSize, keeping maxFiles rotated files
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = defaultOutputMaxSize
+	}
+	if maxFiles <= 0 {
+		maxFiles = defaultOutputMaxFiles
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	return r, r.open()
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, defaultFileMode)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size = file, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+	os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxFiles))
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	renameErr := os.Rename(r.path, r.path+".1")
+	// Keep writing to the current file if it could not be renamed
+	err := r.open()
+	if renameErr != nil {
+		return renameErr
+	}
+	return err
+}
+
+func (r *rotatingFile) Close() error {
+	return r.file.Close()
+}
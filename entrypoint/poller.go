@@ -0,0 +1,207 @@
+package entrypoint
+
+import (
+	"crypto/sha256"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/sys/unix"
+)
+
+const defaultPollInterval = 2 * time.Second
+
+// fileState is what a poll compares to detect that a file changed
+type fileState struct {
+	isDir   bool
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+// poller detects changes to paths by comparing their state every interval,
+// for filesystems where inotify reports nothing. Like fsnotify, a watched
+// directory reports changes to its entries.
+type poller struct {
+	Events chan fsnotify.Event
+
+	interval time.Duration
+	lock     sync.Mutex
+	paths    map[string]map[string]fileState // State of the path, or of each entry of a directory
+	done     chan struct{}
+}
+
+func newPoller(interval time.Duration) *poller {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	p := &poller{
+		Events:   make(chan fsnotify.Event),
+		interval: interval,
+		paths:    make(map[string]map[string]fileState),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Add starts polling path. It does not need to exist yet.
+func (p *poller) Add(path string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.paths[path] = snapshot(path)
+}
+
+func (p *poller) Remove(path string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.paths, path)
+}
+
+func (p *poller) WatchList() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	paths := make([]string, 0, len(p.paths))
+	for path := range p.paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (p *poller) Close() {
+	close(p.done)
+}
+
+func (p *poller) run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		for _, event := range p.poll() {
+			select {
+			case p.Events <- event:
+			case <-p.done:
+				return
+			}
+		}
+	}
+}
+
+// poll compares every path with its previous state, returning an event for
+// each file that was created, written or removed
+func (p *poller) poll() []fsnotify.Event {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var events []fsnotify.Event
+	for path, previous := range p.paths {
+		current := snapshot(path)
+		for name, state := range current {
+			previousState, ok := previous[name]
+			switch {
+			case !ok:
+				events = append(events, fsnotify.Event{Name: name, Op: fsnotify.Create})
+			case state != previousState:
+				events = append(events, fsnotify.Event{Name: name, Op: fsnotify.Write})
+			}
+		}
+		for name := range previous {
+			if _, ok := current[name]; !ok {
+				events = append(events, fsnotify.Event{Name: name, Op: fsnotify.Remove})
+			}
+		}
+		p.paths[path] = current
+	}
+	return events
+}
+
+// snapshot returns the state of path, or of each entry if it is a directory.
+// It is empty if path does not exist.
+func snapshot(path string) map[string]fileState {
+	states := make(map[string]fileState)
+	info, err := os.Stat(path)
+	if err != nil {
+		return states
+	}
+	if !info.IsDir() {
+		states[path] = statFile(path, info)
+		return states
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		slog.Warn("Could not poll directory", "input", path, "error", err)
+		return states
+	}
+	for _, entry := range entries {
+		name := filepath.Join(path, entry.Name())
+		info, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		states[name] = statFile(name, info)
+	}
+	return states
+}
+
+func statFile(path string, info os.FileInfo) fileState {
+	// Only the existence of a directory is compared, as fsnotify does not
+	// report changes inside directories below the watched one
+	if info.IsDir() {
+		return fileState{isDir: true}
+	}
+
+	state := fileState{modTime: info.ModTime(), size: info.Size()}
+	file, err := os.Open(path)
+	if err != nil {
+		return state
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err == nil {
+		copy(state.hash[:], hash.Sum(nil))
+	}
+	return state
+}
+
+// Filesystem magic numbers from statfs(2) of network and userspace
+// filesystems, where inotify does not see changes made by other hosts
+var networkFilesystems = map[int64]string{
+	0x6969:     "nfs",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x517b:     "smb",
+	0x65735546: "fuse",
+	0x00c36400: "ceph",
+	0x01021997: "9p",
+}
+
+// networkFilesystem returns the name of the network filesystem path is on,
+// or an empty string. Paths that do not exist yet use their nearest parent.
+func networkFilesystem(path string) string {
+	var stat unix.Statfs_t
+	for {
+		err := unix.Statfs(path, &stat)
+		if err == nil {
+			return networkFilesystems[int64(stat.Type)]
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return ""
+		}
+		path = parent
+	}
+}
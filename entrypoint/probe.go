@@ -0,0 +1,69 @@
+package entrypoint
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/OpenSourcererPrime/shoehorn/config"
+)
+
+const defaultProbeTimeout = time.Second
+
+// probeClient does not follow redirects, any 3xx status passes a probe
+var probeClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// runProbe runs the check of probe once, returning why it failed
+func runProbe(probe *config.ProbeConfig) error {
+	timeout := probe.Timeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	switch {
+	case len(probe.Exec) > 0:
+		c := exec.CommandContext(ctx, probe.Exec[0], probe.Exec[1:]...)
+		// Do not wait for children of the command holding its output open
+		c.WaitDelay = timeout
+		output, err := c.CombinedOutput()
+		if err != nil {
+			if message := strings.TrimSpace(string(output)); message != "" {
+				err = fmt.Errorf("%w: %s", err, message)
+			}
+			return &ErrorProbe{Probe: strings.Join(probe.Exec, " "), Err: err}
+		}
+
+	case probe.HTTP != "":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe.HTTP, nil)
+		if err != nil {
+			return &ErrorProbe{Probe: probe.HTTP, Err: err}
+		}
+		resp, err := probeClient.Do(req)
+		if err != nil {
+			return &ErrorProbe{Probe: probe.HTTP, Err: err}
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return &ErrorProbe{Probe: probe.HTTP, Err: fmt.Errorf("status %s", resp.Status)}
+		}
+
+	case probe.TCP != "":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", probe.TCP)
+		if err != nil {
+			return &ErrorProbe{Probe: probe.TCP, Err: err}
+		}
+		conn.Close()
+	}
+	return nil
+}
@@ -1,94 +1,243 @@
 package entrypoint
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"strings"
 	"syscall"
+	"time"
+
+	"github.com/OpenSourcererPrime/shoehorn/config"
 )
 
-func (ep *EntryPoint) StartManagedProcess() {
+// stopTimeout is how long the managed process is given to exit before it is killed
+const stopTimeout = 5 * time.Second
+
+// signalsByName are the signals that can be configured by name
+var signalsByName = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+}
+
+func (ep *EntryPoint) StartManagedProcess() error {
+	ep.processLock.Lock()
+	defer ep.processLock.Unlock()
+
+	ep.healthCheckOnce.Do(func() {
+		go ep.runHealthChecks()
+	})
+	return ep.startManagedProcess()
+}
+
+func (ep *EntryPoint) startManagedProcess() error {
 	if ep.appConfig.Process.Path == "" {
-		log.Printf("No process specified to manage, entrypoint will only manage configurations")
-		return
+		slog.Info("No process specified to manage, entrypoint will only manage configurations")
+		return nil
 	}
 
-	log.Printf("Starting managed process: %s %s", ep.appConfig.Process.Path, strings.Join(ep.appConfig.Process.Args, " "))
+	slog.Info("Starting managed process", "path", ep.appConfig.Process.Path, "args", strings.Join(ep.appConfig.Process.Args, " "))
 
-	c := exec.Command(ep.appConfig.Process.Path, ep.appConfig.Process.Args...)
+	c := newManagedCmd(ep.appConfig.Process)
 
-	ep.managedCmd = c
-
-	// Connect process stdin/stdout/stderr to the entrypoint's
-	ep.managedCmd.Stdin = os.Stdin
-	ep.managedCmd.Stdout = os.Stdout
-	ep.managedCmd.Stderr = os.Stderr
+	var capture *outputCapture
+	if needsCapture(ep.appConfig.Process.Output) {
+		var err error
+		capture, err = ep.captureOutput(c)
+		if err != nil {
+			return &ErrorStartProcess{Path: ep.appConfig.Process.Path, Err: err}
+		}
+	}
 
-	err := ep.managedCmd.Start()
+	err := startWithLimits(c, ep.appConfig.Process)
+	if capture != nil {
+		// Only the process holds the write ends of the pipes now, so they
+		// are closed once it and any descendants exit
+		c.Stdout.(*os.File).Close()
+		c.Stderr.(*os.File).Close()
+		capture.start()
+	}
 	if err != nil {
-		log.Fatalf("Failed to start managed process: %v", err)
+		return &ErrorStartProcess{Path: ep.appConfig.Process.Path, Err: err}
 	}
 
-	// Handle process completion in a goroutine
+	done := make(chan struct{})
+	ep.managedCmd = c
+	ep.managedDone = done
+	ep.processStarted = time.Now()
+	ep.metrics.processStarted.Store(ep.processStarted.UnixNano())
+	ep.expectedExit.Store(false)
+	ep.runHooks("onStart", ep.appConfig.Hooks.OnStart, hookEvent{PID: c.Process.Pid})
+
+	// The process lock cannot be taken once the process exits, as it is held
+	// while waiting for the exit
+	onExit := ep.appConfig.Hooks.OnProcessExit
+
+	// Handle process completion in a goroutine, this is the only place the
+	// process is waited on so the exit can be observed through done
 	go func() {
-		err := ep.managedCmd.Wait()
+		err := c.Wait()
+		if capture != nil {
+			capture.wait(outputFlushTimeout)
+		}
+		ep.recordExit(c)
+		close(done)
+
+		event := hookEvent{PID: c.Process.Pid}
+		if c.ProcessState != nil {
+			code := exitCode(c.ProcessState)
+			event.ExitCode = &code
+		}
 		if err != nil {
-			log.Printf("Inside goroutine: managed process exited with error: %v", err)
-			log.Printf("Managed process exited with error: %v", err)
-			os.Exit(1)
+			event.Error = err.Error()
+		}
+		hooks := ep.runHooks("onProcessExit", onExit, event)
+
+		if ep.expectedExit.Load() {
+			return
+		}
+		// shoehorn stops with the process, give the hooks time to finish
+		hooks.Wait()
+		if err != nil {
+			slog.Error("Managed process exited", "pid", c.Process.Pid, "error", err)
+			err = &ErrorProcessExited{PID: c.Process.Pid, Err: err}
 		} else {
-			log.Printf("Managed process completed successfully")
-			os.Exit(0)
+			slog.Info("Managed process completed successfully", "pid", c.Process.Pid)
+		}
+		select {
+		case ep.processExit <- err:
+		default:
 		}
 	}()
+	return nil
 }
 
-func (ep *EntryPoint) reloadManagedProcess() {
+// reloadManagedProcess reloads the managed process with the configured
+// method, restarting it when none is set
+func (ep *EntryPoint) reloadManagedProcess() error {
+	ep.processLock.Lock()
+	defer ep.processLock.Unlock()
+
 	if ep.managedCmd == nil || ep.managedCmd.Process == nil {
-		log.Printf("No managed process to reload")
-		return
+		slog.Warn("No managed process to reload")
+		return &ErrorNoProcess{}
 	}
 
 	switch ep.appConfig.Process.Reload.Method {
-	case "restart":
-		log.Printf("Restarting managed process")
-		// Kill the existing process
-		if err := ep.managedCmd.Process.Signal(syscall.SIGTERM); err != nil {
-			log.Printf("Failed to kill managed process: %v", err)
+	case "signal":
+		slog.Info("Reloading managed process", "method", "signal", "signal", ep.appConfig.Process.Reload.Signal, "pid", ep.managedCmd.Process.Pid)
+		sig, ok := signalsByName[ep.appConfig.Process.Reload.Signal]
+		if !ok {
+			slog.Warn("Unsupported signal, using SIGHUP instead", "signal", ep.appConfig.Process.Reload.Signal)
+			sig = syscall.SIGHUP
+		}
+
+		err := ep.signalManagedProcess(sig)
+		if err != nil {
+			slog.Error("Failed to send signal to managed process", "method", "signal", "pid", ep.managedCmd.Process.Pid, "error", err)
 		}
+		ep.recordReload("signal", err)
+		return err
 
-		// Wait for it to exit (should be near-immediate since we killed it)
-		ep.managedCmd.Wait()
-		ep.managedCmd.Process.Wait()
+	default:
+		slog.Info("Reloading managed process", "method", "restart", "pid", ep.managedCmd.Process.Pid)
+		err := ep.restartManagedProcess()
+		if err != nil {
+			slog.Error("Failed to restart managed process", "method", "restart", "error", err)
+		}
+		ep.recordReload("restart", err)
+		return err
+	}
+}
 
-		// Start it again with the same arguments
-		ep.StartManagedProcess()
+// restartManagedProcess stops the managed process if it is running and starts
+// it again with the current process settings
+func (ep *EntryPoint) restartManagedProcess() error {
+	ep.stopManagedProcess(syscall.SIGTERM, stopTimeout)
+	err := ep.startManagedProcess()
+	if err == nil {
+		ep.metrics.restarts.Inc()
+	}
+	return err
+}
 
-	case "signal":
-		log.Printf("Sending %s to managed process", ep.appConfig.Process.Reload.Signal)
-		var sig syscall.Signal
+// signalManagedProcess sends sig to the managed process, or to its whole
+// process group when processGroup is enabled
+func (ep *EntryPoint) signalManagedProcess(sig syscall.Signal) error {
+	if ep.appConfig.Process.ProcessGroup {
+		return syscall.Kill(-ep.managedCmd.Process.Pid, sig)
+	}
+	return ep.managedCmd.Process.Signal(sig)
+}
 
-		// Convert string signal name to actual signal
-		switch ep.appConfig.Process.Reload.Signal {
-		case "SIGHUP":
-			sig = syscall.SIGHUP
-		case "SIGUSR1":
-			sig = syscall.SIGUSR1
-		case "SIGUSR2":
-			sig = syscall.SIGUSR2
-		case "SIGTERM":
-			sig = syscall.SIGTERM
-		case "SIGINT":
-			sig = syscall.SIGINT
-		default:
-			log.Printf("Unsupported signal: %s, using SIGHUP instead", ep.appConfig.Process.Reload.Signal)
-			sig = syscall.SIGHUP
-		}
+// stopManagedProcess sends sig to the managed process and its descendants and
+// waits for them to exit, killing them once timeout has passed
+func (ep *EntryPoint) stopManagedProcess(sig syscall.Signal, timeout time.Duration) {
+	if ep.managedCmd == nil || ep.managedCmd.Process == nil {
+		return
+	}
 
-		err := ep.managedCmd.Process.Signal(sig)
-		if err != nil {
-			log.Printf("Failed to send signal to managed process: %v", err)
+	select {
+	case <-ep.managedDone:
+		// Already exited, nothing to stop
+		return
+	default:
+	}
+
+	ep.expectedExit.Store(true)
+	pid := ep.managedCmd.Process.Pid
+	deadline := time.Now().Add(timeout)
+
+	// Collect descendants up front, once the process has exited they are
+	// reparented and can no longer be found through it
+	root, _ := findProcess(pid)
+	descendants := findDescendants(root)
+
+	err := ep.signalManagedProcess(sig)
+	if err != nil {
+		slog.Error("Failed to send signal to managed process", "pid", pid, "error", err)
+	}
+	if !ep.appConfig.Process.ProcessGroup {
+		// The process group already received sig
+		for _, descendant := range descendants {
+			descendant.signal(sig)
 		}
 	}
+
+	select {
+	case <-ep.managedDone:
+		slog.Info("Managed process exited gracefully", "pid", pid)
+	case <-time.After(time.Until(deadline)):
+		slog.Warn("Timeout waiting for managed process to exit, forcing termination", "pid", pid)
+		descendants = append(descendants, findDescendants(root)...)
+		ep.signalManagedProcess(syscall.SIGKILL)
+		<-ep.managedDone
+	}
+
+	// Descendants get the rest of the timeout to exit, and are only killed
+	// while they are still the processes that were found
+	remaining := waitForProcesses(descendants, deadline)
+	if ep.appConfig.Process.ProcessGroup {
+		syscall.Kill(-pid, syscall.SIGKILL)
+	}
+	for _, descendant := range remaining {
+		slog.Warn("Killing descendant of managed process", "pid", descendant.pid)
+		descendant.signal(syscall.SIGKILL)
+	}
+}
+
+func newManagedCmd(processConfig config.ProcessConfig) *exec.Cmd {
+	c := exec.Command(processConfig.Path, processConfig.Args...)
+	c.Dir = processConfig.WorkingDir
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: processConfig.ProcessGroup}
+
+	// Connect process stdin/stdout/stderr to the entrypoint's
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	return c
 }
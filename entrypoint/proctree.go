@@ -0,0 +1,131 @@
+package entrypoint
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// processID identifies a process by its pid and start time, so that a pid
+// reused by an unrelated process after the original exited is not mistaken
+// for it
+type processID struct {
+	pid       int
+	startTime uint64 // Clock ticks since boot
+}
+
+// procStat is the part of /proc/<pid>/stat used to walk the process tree
+type procStat struct {
+	state     string
+	parentPid int
+	startTime uint64
+}
+
+// readProcStat returns the state, parent and start time of pid
+func readProcStat(pid int) (procStat, bool) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return procStat{}, false
+	}
+
+	// The command name is wrapped in parentheses and may contain spaces, so
+	// fields are counted from the last closing parenthesis, starting with
+	// the state as the third field
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 20 {
+		return procStat{}, false
+	}
+	parentPid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return procStat{}, false
+	}
+	startTime, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return procStat{}, false
+	}
+	return procStat{state: fields[0], parentPid: parentPid, startTime: startTime}, true
+}
+
+// findProcess returns the identity of the running process pid
+func findProcess(pid int) (processID, bool) {
+	stat, ok := readProcStat(pid)
+	if !ok {
+		return processID{}, false
+	}
+	return processID{pid: pid, startTime: stat.startTime}, true
+}
+
+// running reports whether the process is still the one identified by id and
+// has not exited, treating zombies as exited
+func (id processID) running() bool {
+	stat, ok := readProcStat(id.pid)
+	return ok && stat.startTime == id.startTime && stat.state != "Z"
+}
+
+// signal sends sig to the process unless it exited, so that a reused pid is
+// never signalled
+func (id processID) signal(sig syscall.Signal) {
+	if id.running() {
+		syscall.Kill(id.pid, sig)
+	}
+}
+
+// findDescendants returns every process below root in the process tree,
+// based on the parent pids reported in /proc. Nothing is returned once root
+// exited, as its pid may belong to another process by then.
+func findDescendants(root processID) []processID {
+	statFiles, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil || !root.running() {
+		return nil
+	}
+
+	children := make(map[int][]processID)
+	for _, statFile := range statFiles {
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(statFile)))
+		if err != nil {
+			continue
+		}
+		stat, ok := readProcStat(pid)
+		if !ok {
+			// The process exited while walking the tree
+			continue
+		}
+		children[stat.parentPid] = append(children[stat.parentPid], processID{pid: pid, startTime: stat.startTime})
+	}
+
+	var descendants []processID
+	queue := children[root.pid]
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		// A child cannot have started before its parent
+		if next.startTime < root.startTime {
+			continue
+		}
+		descendants = append(descendants, next)
+		queue = append(queue, children[next.pid]...)
+	}
+	return descendants
+}
+
+// waitForProcesses waits until every process has exited or deadline passed,
+// returning the ones still running
+func waitForProcesses(processes []processID, deadline time.Time) []processID {
+	for {
+		var running []processID
+		for _, process := range processes {
+			if process.running() {
+				running = append(running, process)
+			}
+		}
+		if len(running) == 0 || !time.Now().Before(deadline) {
+			return running
+		}
+		processes = running
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,204 @@
+package entrypoint
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/OpenSourcererPrime/shoehorn/config"
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchConfig makes WatchForChanges reload the config at configPath when it,
+// or any fragment it includes, changes. extraArgs are appended to the process
+// args of every reloaded config, as they were for the initial one.
+func (ep *EntryPoint) WatchConfig(configPath string, extraArgs []string) {
+	ep.configPath = configPath
+	ep.extraArgs = extraArgs
+	ep.configDirs = make(map[string]bool)
+
+	ep.watchConfigSources(append([]string{configPath}, ep.appConfig.Sources()...))
+}
+
+// watchConfigSources watches the directories containing the config sources.
+// Watching the directory rather than the file keeps working when the config
+// is replaced, e.g. by the symlink swap of a Kubernetes ConfigMap.
+func (ep *EntryPoint) watchConfigSources(sources []string) {
+	for _, source := range sources {
+		dir := source
+		if info, err := os.Stat(source); err != nil || !info.IsDir() {
+			dir = filepath.Dir(source)
+		}
+		if ep.configDirs[dir] {
+			continue
+		}
+
+		err := ep.addWatch(dir)
+		if err != nil {
+			slog.Warn("Could not watch config directory", "path", dir, "error", err)
+			continue
+		}
+		slog.Info("Watching config directory", "path", dir)
+		ep.configDirs[dir] = true
+	}
+}
+
+// isConfigEvent reports whether event changes the config. Other files in the
+// watched config directories, such as editor swap files, are ignored, except
+// for the ..data symlink swapped when a Kubernetes ConfigMap is updated.
+func (ep *EntryPoint) isConfigEvent(event fsnotify.Event) bool {
+	if ep.configDirs[event.Name] {
+		return true
+	}
+	if !ep.configDirs[filepath.Dir(event.Name)] {
+		return false
+	}
+	return filepath.Base(event.Name) == "..data" || event.Name == filepath.Clean(ep.configPath) || ep.appConfig.IsSource(event.Name)
+}
+
+// reloadConfig loads the config again and applies it, keeping the running
+// config if the new one is invalid
+func (ep *EntryPoint) reloadConfig() {
+	newConfig, err := config.LoadConfigFile(ep.configPath)
+	if err != nil {
+		slog.Error("Rejected new config, keeping the running config", "config", ep.configPath, "error", err)
+		return
+	}
+
+	err = ValidateTemplates(newConfig)
+	if err != nil {
+		slog.Error("Rejected new config, keeping the running config", "config", ep.configPath, "error", err)
+		return
+	}
+
+	newConfig.Process.Args = append(newConfig.Process.Args, ep.extraArgs...)
+	ep.applyConfig(newConfig)
+}
+
+// applyConfig replaces the running config with newConfig. Added and changed
+// outputs are generated and watched, and the managed process is restarted
+// only when its settings changed. Hooks and the readiness probe are used as
+// soon as they are applied, settings that only take effect when shoehorn
+// starts keep their running value.
+func (ep *EntryPoint) applyConfig(newConfig *config.Config) {
+	// Fragments may have been added to the config
+	ep.watchConfigSources(newConfig.Sources())
+
+	oldConfig := ep.appConfig
+	for _, setting := range keepStartupSettings(&oldConfig, newConfig) {
+		slog.Warn("Changed setting requires restarting shoehorn, keeping the running value", "setting", setting)
+	}
+	if reflect.DeepEqual(oldConfig.Generate, newConfig.Generate) && reflect.DeepEqual(oldConfig.Process, newConfig.Process) &&
+		reflect.DeepEqual(oldConfig.Hooks, newConfig.Hooks) && reflect.DeepEqual(oldConfig.Health, newConfig.Health) {
+		return
+	}
+	slog.Info("Applying new config", "config", ep.configPath)
+
+	oldOutputs := make(map[string]config.GenerateConfig)
+	for _, gen := range oldConfig.Generate {
+		oldOutputs[OutputPath(gen)] = gen
+	}
+
+	var outdated []config.GenerateConfig
+	for _, gen := range newConfig.Generate {
+		outputPath := OutputPath(gen)
+		oldGen, ok := oldOutputs[outputPath]
+		delete(oldOutputs, outputPath)
+
+		switch {
+		case !ok:
+			slog.Info("Adding output", "name", gen.Name, "output", outputPath)
+		case !reflect.DeepEqual(oldGen, gen):
+			slog.Info("Updating output", "name", gen.Name, "output", outputPath)
+		default:
+			continue
+		}
+		outdated = append(outdated, gen)
+	}
+	for outputPath, oldGen := range oldOutputs {
+		slog.Info("No longer generating output", "name", oldGen.Name, "output", outputPath)
+	}
+
+	ep.updateWatches(watchedPaths(&oldConfig), watchedPaths(newConfig))
+
+	// Settings that only affect how the process is reloaded or checked do not
+	// require restarting it
+	oldProcess, newProcess := oldConfig.Process, newConfig.Process
+	oldProcess.Reload, newProcess.Reload = config.ReloadConfig{}, config.ReloadConfig{}
+	oldProcess.HealthCheck, newProcess.HealthCheck = nil, nil
+	processChanged := !reflect.DeepEqual(oldProcess, newProcess)
+
+	ep.processLock.Lock()
+	ep.appConfig = *newConfig
+	ep.processLock.Unlock()
+
+	for _, gen := range outdated {
+		ep.generateOutput(gen, nil)
+	}
+
+	if processChanged {
+		slog.Info("Process settings changed, restarting managed process")
+		ep.processLock.Lock()
+		err := ep.restartManagedProcess()
+		ep.processLock.Unlock()
+		if err != nil {
+			slog.Error("Failed to restart managed process", "error", err)
+		}
+	} else if len(outdated) > 0 && ep.appConfig.Process.Reload.Enabled {
+		ep.reloadManagedProcess()
+	}
+}
+
+// keepStartupSettings resets the settings of newConfig that are only used
+// when shoehorn starts to their running value, returning the ones that
+// changed
+func keepStartupSettings(running, newConfig *config.Config) []string {
+	var changed []string
+	if newConfig.Watch != running.Watch {
+		changed = append(changed, "watch")
+		newConfig.Watch = running.Watch
+	}
+	if newConfig.Metrics != running.Metrics {
+		changed = append(changed, "metrics")
+		newConfig.Metrics = running.Metrics
+	}
+	if newConfig.Health.Listen != running.Health.Listen {
+		changed = append(changed, "health.listen")
+		newConfig.Health.Listen = running.Health.Listen
+	}
+	if newConfig.Log != running.Log {
+		changed = append(changed, "log")
+		newConfig.Log = running.Log
+	}
+	if newConfig.Control != running.Control {
+		changed = append(changed, "control")
+		newConfig.Control = running.Control
+	}
+	return changed
+}
+
+// updateWatches stops watching paths that are no longer used and starts
+// watching new ones
+func (ep *EntryPoint) updateWatches(oldPaths, newPaths map[string]bool) {
+	var added []string
+	for path := range newPaths {
+		if !oldPaths[path] {
+			added = append(added, path)
+		}
+	}
+	sort.Strings(added)
+	for _, path := range added {
+		ep.watchPath(path)
+	}
+
+	for path := range oldPaths {
+		// Config directories stay watched for reloading the config
+		if !newPaths[path] && !ep.configDirs[path] {
+			ep.forgetMissing(path)
+			ep.removeWatch(path)
+			slog.Info("Stopped watching file", "input", path)
+		}
+	}
+}
@@ -1,93 +1,351 @@
 package entrypoint
 
 import (
-	"log"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"slices"
 	"time"
 
+	"github.com/OpenSourcererPrime/shoehorn/config"
 	"github.com/fsnotify/fsnotify"
 )
 
-func (ep *EntryPoint) setupWatcher() {
+func (ep *EntryPoint) setupWatcher() error {
 	var err error
 	ep.watcher, err = fsnotify.NewWatcher()
 	if err != nil {
-		log.Fatalf("Failed to create file watcher: %v", err)
+		return &ErrorCreateWatcher{Err: err}
 	}
+	ep.poller = newPoller(ep.appConfig.Watch.PollInterval)
 
 	// Add all input files to the watcher
 	for _, gen := range ep.appConfig.Generate {
-		for _, input := range gen.Inputs {
-			err = ep.watcher.Add(input.Path)
-			if err != nil {
-				log.Printf("Warning: Could not watch file %s: %v", input.Path, err)
-			} else {
-				log.Printf("Watching file: %s", input.Path)
-			}
+		ep.watchGenerate(gen)
+	}
+	return nil
+}
+
+// watchGenerate adds the inputs of gen, and its template when using the
+// template strategy, to the watcher
+func (ep *EntryPoint) watchGenerate(gen config.GenerateConfig) {
+	for _, target := range generateWatchTargets(gen) {
+		ep.watchPath(target)
+	}
+}
+
+// generateWatchTargets returns the paths to watch for changes to the inputs
+// and templates of gen
+func generateWatchTargets(gen config.GenerateConfig) []string {
+	var targets []string
+	for _, input := range gen.Inputs {
+		// The environment does not change while shoehorn runs
+		if input.Env != "" {
+			continue
 		}
+		targets = append(targets, inputWatchTargets(input.Path)...)
+	}
 
-		// If using template strategy, also watch the template file
-		if gen.Strategy == "template" && gen.Template != "" {
-			err = ep.watcher.Add(gen.Template)
-			if err != nil {
-				log.Printf("Warning: Could not watch template file %s: %v", gen.Template, err)
-			} else {
-				log.Printf("Watching template file: %s", gen.Template)
-			}
+	// If using template strategy, also watch the template file
+	if gen.Strategy == "template" && gen.Template != "" {
+		targets = append(targets, gen.Template)
+	}
+
+	// If using directory strategy, watch every directory of the source tree,
+	// or the source tree itself until it exists
+	if gen.Strategy == "directory" {
+		dirs := sourceDirs(gen)
+		if len(dirs) == 0 {
+			dirs = []string{gen.Template}
 		}
+		targets = append(targets, dirs...)
+	}
+	return targets
+}
+
+func (ep *EntryPoint) watchPath(path string) {
+	if ep.isWatched(path) {
+		return
+	}
+
+	err := ep.addWatch(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		ep.watchMissing(path)
+	} else if err != nil {
+		slog.Warn("Could not watch file", "input", path, "error", err)
+	} else {
+		slog.Info("Watching file", "input", path)
 	}
 }
 
+func (ep *EntryPoint) isWatched(path string) bool {
+	_, missing := ep.missing[path]
+	return missing || slices.Contains(ep.watcher.WatchList(), path) || slices.Contains(ep.poller.WatchList(), path)
+}
+
+// addWatch watches path with inotify, or by polling it when the watch mode
+// is poll, or auto and inotify cannot be used for path
+func (ep *EntryPoint) addWatch(path string) error {
+	mode := ep.appConfig.Watch.Mode
+	if mode == "poll" {
+		ep.poller.Add(path)
+		return nil
+	}
+	if mode == "auto" {
+		if fsType := networkFilesystem(path); fsType != "" {
+			slog.Info("Polling file on a network filesystem", "input", path, "filesystem", fsType)
+			ep.poller.Add(path)
+			return nil
+		}
+	}
+
+	// Paths that do not exist yet are handled by watchMissing
+	err := ep.watcher.Add(path)
+	if err != nil && mode == "auto" && !errors.Is(err, fs.ErrNotExist) {
+		slog.Info("Polling file that cannot be watched", "input", path, "error", err)
+		ep.poller.Add(path)
+		return nil
+	}
+	return err
+}
+
+// removeWatch stops watching path, however it was watched
+func (ep *EntryPoint) removeWatch(path string) {
+	// The path may never have been watched if it did not exist
+	ep.watcher.Remove(path)
+	ep.poller.Remove(path)
+}
+
+// watchedPaths returns every input and template path of appConfig, with
+// globs replaced by the directories they match in
+func watchedPaths(appConfig *config.Config) map[string]bool {
+	paths := make(map[string]bool)
+	for _, gen := range appConfig.Generate {
+		for _, target := range generateWatchTargets(gen) {
+			paths[target] = true
+		}
+	}
+	return paths
+}
+
 func (ep *EntryPoint) WatchForChanges() {
-	var lastEventTime time.Time
+	defer ep.watchStopped.Store(true)
+
 	debounceInterval := 100 * time.Millisecond
 
+	// Changes are applied once no further events arrived for the debounce
+	// interval, so partially written files or configs are never used
+	var configReload, regenerate <-chan time.Time
+	pending := make(map[string][]string) // Changed inputs of each output to regenerate
+	configChanged := false               // Set when the config changed while paused
+
+	handleEvent := func(event fsnotify.Event) {
+		// Regenerate outputs of inputs that appeared, or were replaced
+		for _, path := range ep.updateMissing(event) {
+			for _, gen := range ep.appConfig.Generate {
+				if slices.Contains(generateWatchTargets(gen), path) {
+					slog.Info("Input appeared", "name", gen.Name, "output", OutputPath(gen), "input", path)
+					pending[OutputPath(gen)] = appendInput(pending[OutputPath(gen)], path)
+					regenerate = time.After(debounceInterval)
+				}
+			}
+		}
+
+		if ep.isConfigEvent(event) {
+			// The event may also be for an input in the config directory
+			configReload = time.After(debounceInterval)
+		}
+
+		// Find which configs this file belongs to
+		for _, gen := range ep.appConfig.Generate {
+			if !affectedBy(gen, event.Name, event.Op) {
+				continue
+			}
+			slog.Info("Input changed", "name", gen.Name, "output", OutputPath(gen), "input", event.Name, "op", event.Op.String())
+			pending[OutputPath(gen)] = appendInput(pending[OutputPath(gen)], event.Name)
+			regenerate = time.After(debounceInterval)
+
+			// A new directory may match a glob input or be added to a
+			// source tree
+			if event.Has(fsnotify.Create) {
+				ep.watchGenerate(gen)
+			}
+		}
+	}
+
+	// A periodic resync regenerates outputs whose changes were missed
+	var resync <-chan time.Time
+	if interval := ep.appConfig.Watch.ResyncInterval; interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		resync = ticker.C
+	}
+
+	// Outputs with a refresh interval are rendered again on their schedule
+	refreshes := make(map[string]time.Time) // When each output is next refreshed
+	var refresh <-chan time.Time
+	scheduleRefresh := func() {
+		outdated, wait := ep.dueRefreshes(refreshes, time.Now())
+		for _, outputPath := range outdated {
+			if _, ok := pending[outputPath]; !ok {
+				pending[outputPath] = nil
+			}
+			// Refreshes more frequent than the debounce interval must not
+			// postpone regenerating forever
+			if regenerate == nil {
+				regenerate = time.After(debounceInterval)
+			}
+		}
+		refresh = nil
+		if wait > 0 {
+			refresh = time.After(wait)
+		}
+	}
+	scheduleRefresh()
+
+	// The heartbeat is only recorded while the loop is not stuck handling
+	// an event
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	ep.heartbeat.Store(time.Now().UnixNano())
+
 	for {
 		select {
+		case <-heartbeat.C:
+			ep.heartbeat.Store(time.Now().UnixNano())
+		case <-configReload:
+			configReload = nil
+			if ep.paused.Load() {
+				configChanged = true
+			} else {
+				ep.reloadConfig()
+				scheduleRefresh()
+			}
+		case <-refresh:
+			scheduleRefresh()
+		case <-regenerate:
+			regenerate = nil
+			// Pending changes are kept until watching is resumed
+			if !ep.paused.Load() {
+				ep.regenerateOutputs(pending)
+				pending = make(map[string][]string)
+			}
+		case <-resync:
+			if !ep.paused.Load() {
+				ep.resyncOutputs()
+			}
+		case call := <-ep.calls:
+			call()
+			if !ep.paused.Load() {
+				if configChanged {
+					configChanged = false
+					configReload = time.After(debounceInterval)
+				}
+				if len(pending) > 0 && regenerate == nil {
+					regenerate = time.After(debounceInterval)
+				}
+			}
 		case event, ok := <-ep.watcher.Events:
 			if !ok {
 				return
 			}
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				// Debounce events to prevent multiple rapid regenerations
-				now := time.Now()
-				if now.Sub(lastEventTime) > debounceInterval {
-					lastEventTime = now
-					log.Printf("File modified: %s", event.Name)
-
-					// Find which config this file belongs to
-					for _, gen := range ep.appConfig.Generate {
-						needsRegeneration := false
-
-						// Check if it's one of the input files
-						for _, input := range gen.Inputs {
-							if input.Path == event.Name {
-								needsRegeneration = true
-								break
-							}
-						}
-
-						// Check if it's the template file
-						if gen.Strategy == "template" && gen.Template == event.Name {
-							needsRegeneration = true
-						}
-
-						if needsRegeneration {
-							log.Printf("Regenerating output: %s", gen.Name)
-							generateFile(gen)
-
-							// If reload is enabled, reload the managed process
-							if ep.appConfig.Process.Reload.Enabled {
-								ep.reloadManagedProcess()
-							}
-						}
-					}
-				}
-			}
+			handleEvent(event)
+		case event := <-ep.poller.Events:
+			handleEvent(event)
 		case err, ok := <-ep.watcher.Errors:
 			if !ok {
 				return
 			}
-			log.Printf("Watcher error: %v", err)
+			slog.Error("Watcher error", "error", err)
+			ep.metrics.watcherErrors.Inc()
 		}
 	}
 }
+
+// dueRefreshes returns the outputs whose refresh is due at now and that
+// render differently than their current content, and how long to wait for
+// the next refresh. refreshes holds when each output is next refreshed and
+// is updated for the outputs and refresh intervals of the current config.
+func (ep *EntryPoint) dueRefreshes(refreshes map[string]time.Time, now time.Time) ([]string, time.Duration) {
+	var outdated []string
+	var next time.Time
+	scheduled := make(map[string]bool)
+	for _, gen := range ep.appConfig.Generate {
+		if gen.RefreshInterval <= 0 {
+			continue
+		}
+		outputPath := OutputPath(gen)
+		scheduled[outputPath] = true
+
+		due, ok := refreshes[outputPath]
+		switch {
+		case !ok, due.After(now.Add(gen.RefreshInterval)):
+			// Not refreshed before, or the interval was shortened
+			due = now.Add(gen.RefreshInterval)
+		case !now.Before(due):
+			if outputOutdated(gen) {
+				slog.Info("Refresh found outdated output", "name", gen.Name, "output", outputPath)
+				outdated = append(outdated, outputPath)
+			}
+			due = now.Add(gen.RefreshInterval)
+		}
+		refreshes[outputPath] = due
+		if next.IsZero() || due.Before(next) {
+			next = due
+		}
+	}
+
+	// Outputs may have been removed from the config, or no longer refreshed
+	for outputPath := range refreshes {
+		if !scheduled[outputPath] {
+			delete(refreshes, outputPath)
+		}
+	}
+
+	if next.IsZero() {
+		return outdated, 0
+	}
+	return outdated, next.Sub(now)
+}
+
+// resyncOutputs regenerates every output that differs from what its inputs
+// render to now
+func (ep *EntryPoint) resyncOutputs() {
+	outdated := make(map[string][]string)
+	for _, gen := range ep.appConfig.Generate {
+		if outputOutdated(gen) {
+			slog.Info("Resync found outdated output", "name", gen.Name, "output", OutputPath(gen))
+			outdated[OutputPath(gen)] = nil
+		}
+	}
+	ep.regenerateOutputs(outdated)
+}
+
+// regenerateOutputs generates the outputs at the paths in changes, which maps
+// each to the inputs that changed, and then reloads the managed process once
+// if reload is enabled
+func (ep *EntryPoint) regenerateOutputs(changes map[string][]string) {
+	regenerated := false
+	for _, gen := range ep.appConfig.Generate {
+		changedInputs, ok := changes[OutputPath(gen)]
+		if !ok {
+			continue
+		}
+		slog.Info("Regenerating output", "name", gen.Name, "output", OutputPath(gen), "strategy", gen.Strategy)
+		ep.generateOutput(gen, changedInputs)
+		regenerated = true
+	}
+
+	// If reload is enabled, reload the managed process
+	if regenerated && ep.appConfig.Process.Reload.Enabled {
+		ep.reloadManagedProcess()
+	}
+}
+
+// appendInput adds input to the changed inputs of an output, once
+func appendInput(inputs []string, input string) []string {
+	if slices.Contains(inputs, input) {
+		return inputs
+	}
+	return append(inputs, input)
+}
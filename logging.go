@@ -0,0 +1,24 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/OpenSourcererPrime/shoehorn/config"
+)
+
+// newLogger returns a logger writing to w in the configured format, with
+// lines below the configured level dropped
+func newLogger(logConfig config.LogConfig, w io.Writer) *slog.Logger {
+	var level slog.Level
+	if logConfig.Level != "" {
+		// Validated by the config, so this cannot fail
+		level.UnmarshalText([]byte(logConfig.Level))
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	if logConfig.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
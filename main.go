@@ -1,47 +1,86 @@
 package main
 
 import (
-	"log"
+	"fmt"
 	"os"
 
-	"github.com/OpenSourcererPrime/shoehorn/config"
 	"github.com/OpenSourcererPrime/shoehorn/entrypoint"
 )
 
-func main() {
-	if len(os.Args) < 2 {
-		log.Fatal("Usage: shoehorn <shoehorn.yaml> [args for managed process...]")
-	}
+// Exit codes returned by the shoehorn commands
+const (
+	exitOK            = 0
+	exitError         = 1 // Runtime failure, e.g. the managed process failed
+	exitUsage         = 2 // Invalid command line
+	exitInvalidConfig = 3 // The config could not be loaded or is invalid
+	exitRenderFailed  = 4 // One or more outputs could not be rendered or written
+	exitDiffFound     = 5 // diff found outputs that would change
+)
 
-	configPath := os.Args[1]
-	extraArgs := os.Args[2:]
+const usage = `Usage: shoehorn <command> [arguments]
 
-	log.Printf("Starting shoehorn with config: %s", configPath)
+Commands:
+  run [flags] <shoehorn.yaml> [args...]
+                                  Generate outputs, start the managed process and watch for changes
+  render [flags] <shoehorn.yaml>  Generate all outputs once and exit
+  validate <shoehorn.yaml>        Check the config and that referenced templates parse
+  diff <shoehorn.yaml>            Show how the outputs would change, exits with 5 if they would
+  check <shoehorn.yaml>           Alias for diff
+  ctl [--socket <path>] <command> [output]
+                                  Send a command to the control socket of a running shoehorn:
+                                  outputs, process, regenerate, reload, restart, pause or resume
+  schema                          Print the JSON Schema of shoehorn.yaml
+  version                         Print build information
 
-	r, err := os.Open(configPath)
-	if err != nil {
-		log.Fatalf("Failed to open config file: %v", err)
-	}
+Flags for run and render:
+  --dry-run                       Write outputs to stdout instead of their configured paths,
+                                  without starting the process
+  --output-root <dir>             Write outputs beneath <dir> instead of their configured paths,
+                                  implies --dry-run
 
-	defer r.Close()
-	appConfig, err := config.LoadConfig(r)
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
-	}
-	appConfig.Process.Args = append(appConfig.Process.Args, extraArgs...)
+For compatibility, 'shoehorn <shoehorn.yaml> [args...]' is the same as 'shoehorn run'.
+`
+
+type command func(args []string) int
+
+var commands = map[string]command{
+	"run":      runCommand,
+	"render":   renderCommand,
+	"validate": validateCommand,
+	"diff":     diffCommand,
+	"check":    diffCommand,
+	"ctl":      ctlCommand,
+	"schema":   schemaCommand,
+	"version":  versionCommand,
+}
 
-	ep, err := entrypoint.NewEntryPoint(appConfig)
-	if err != nil {
-		log.Fatalf("Failed to create entrypoint: %v", err)
+func main() {
+	// A managed process with a umask or resource limits is started through
+	// shoehorn, which applies them and executes the process in its place
+	if limits, ok := os.LookupEnv(entrypoint.LimitsEnv); ok {
+		entrypoint.ExecWithLimits(limits)
+		os.Exit(127)
 	}
-	defer ep.Close()
 
-	// Start the managed process
-	ep.StartManagedProcess()
+	os.Exit(runCLI(os.Args[1:]))
+}
 
-	// Watch for changes in a separate goroutine
-	go ep.WatchForChanges()
+func runCLI(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
 
-	// Handle signals for graceful termination
-	ep.HandleSignals()
+	switch args[0] {
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return exitOK
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		// Positional form from before subcommands existed
+		return runCommand(args)
+	}
+	return cmd(args[1:])
 }
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OpenSourcererPrime/shoehorn/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestConfig writes an input, a template and a shoehorn.yaml rendering
+// both into outputDir, returning the config path
+func writeTestConfig(t *testing.T, template string) (string, string) {
+	testDir := t.TempDir()
+	outputDir := filepath.Join(testDir, "out")
+
+	inputFile := filepath.Join(testDir, "input.txt")
+	err := os.WriteFile(inputFile, []byte("test content\n"), 0o644)
+	require.NoError(t, err)
+
+	templateFile := filepath.Join(testDir, "output.tmpl")
+	err = os.WriteFile(templateFile, []byte(template), 0o644)
+	require.NoError(t, err)
+
+	configPath := filepath.Join(testDir, "shoehorn.yaml")
+	err = os.WriteFile(configPath, []byte(`
+generate:
+  - name: appended.txt
+    path: `+outputDir+`
+    strategy: append
+    inputs:
+      - name: input
+        path: `+inputFile+`
+  - name: templated.txt
+    path: `+outputDir+`
+    strategy: template
+    template: `+templateFile+`
+    inputs:
+      - name: input
+        path: `+inputFile+`
+`), 0o644)
+	require.NoError(t, err)
+
+	return configPath, outputDir
+}
+
+func TestCLIExitCodes(t *testing.T) {
+	configPath, _ := writeTestConfig(t, "{{.input}}")
+	brokenTemplatePath, _ := writeTestConfig(t, "{{.input")
+
+	invalidConfigPath := filepath.Join(t.TempDir(), "shoehorn.yaml")
+	err := os.WriteFile(invalidConfigPath, []byte("generate:\n  - strategy: unknown\n"), 0o644)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected int
+	}{
+		{"no arguments", []string{}, exitUsage},
+		{"help", []string{"help"}, exitOK},
+		{"version", []string{"version"}, exitOK},
+		{"render without config", []string{"render"}, exitUsage},
+		{"validate", []string{"validate", configPath}, exitOK},
+		{"validate invalid config", []string{"validate", invalidConfigPath}, exitInvalidConfig},
+		{"validate missing config", []string{"validate", filepath.Join(t.TempDir(), "missing.yaml")}, exitInvalidConfig},
+		{"validate broken template", []string{"validate", brokenTemplatePath}, exitInvalidConfig},
+		{"render broken template", []string{"render", brokenTemplatePath}, exitRenderFailed},
+		{"run invalid config", []string{"run", invalidConfigPath}, exitInvalidConfig},
+		{"positional invalid config", []string{invalidConfigPath}, exitInvalidConfig},
+		{"ctl without command", []string{"ctl"}, exitUsage},
+		{"ctl without socket", []string{"ctl", "--socket", filepath.Join(t.TempDir(), "missing.sock"), "outputs"}, exitError},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, runCLI(tc.args))
+		})
+	}
+}
+
+func TestRenderAndDiff(t *testing.T) {
+	configPath, outputDir := writeTestConfig(t, "value: {{.input}}")
+
+	// Nothing has been rendered yet
+	assert.Equal(t, exitDiffFound, runCLI([]string{"diff", configPath}))
+
+	assert.Equal(t, exitOK, runCLI([]string{"render", configPath}))
+
+	content, err := os.ReadFile(filepath.Join(outputDir, "appended.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "test content\n", string(content))
+
+	content, err = os.ReadFile(filepath.Join(outputDir, "templated.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "value: test content\n", string(content))
+
+	// The outputs are up to date after rendering
+	assert.Equal(t, exitOK, runCLI([]string{"diff", configPath}))
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	current := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	rendered := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+
+	expected := `--- out.txt
++++ out.txt (rendered)
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -8,3 +8,4 @@
+ h
+ i
+ j
++k
+`
+	assert.Equal(t, expected, unifiedDiff("out.txt", current, rendered))
+	assert.Empty(t, unifiedDiff("out.txt", current, current))
+}
+
+func TestRenderOutputRoot(t *testing.T) {
+	configPath, outputDir := writeTestConfig(t, "value: {{.input}}")
+	outputRoot := t.TempDir()
+
+	assert.Equal(t, exitOK, runCLI([]string{"render", "--output-root", outputRoot, configPath}))
+
+	content, err := os.ReadFile(filepath.Join(outputRoot, outputDir, "templated.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "value: test content\n", string(content))
+
+	// The configured output path is left untouched
+	_, err = os.Stat(outputDir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRunDryRunToStdout(t *testing.T) {
+	configPath, outputDir := writeTestConfig(t, "value: {{.input}}")
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	code := runCLI([]string{"run", "--dry-run", configPath})
+	w.Close()
+	output, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "==> "+filepath.Join(outputDir, "appended.txt")+" <==\ntest content\n"+
+		"==> "+filepath.Join(outputDir, "templated.txt")+" <==\nvalue: test content\n", string(output))
+
+	_, err = os.Stat(outputDir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPublishedSchemaIsCurrent(t *testing.T) {
+	published, err := os.ReadFile("shoehorn.schema.json")
+	require.NoError(t, err)
+
+	schema, err := config.MarshalSchema()
+	require.NoError(t, err)
+
+	assert.Equal(t, string(schema), string(published), "shoehorn.schema.json is out of date, run 'make schema'")
+}
+
+func TestNewLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := newLogger(config.LogConfig{Format: "json", Level: "warn"}, &buffer)
+
+	logger.Info("Generated output", "output", "/etc/app.conf")
+	logger.Warn("Could not watch file", "path", "/missing", "error", errors.New("no such file"))
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &line))
+	assert.Equal(t, "WARN", line["level"])
+	assert.Equal(t, "Could not watch file", line["msg"])
+	assert.Equal(t, "/missing", line["path"])
+	assert.Equal(t, "no such file", line["error"])
+
+	buffer.Reset()
+	newLogger(config.LogConfig{}, &buffer).Info("Generated output", "output", "/etc/app.conf")
+	assert.Contains(t, buffer.String(), `level=INFO msg="Generated output" output=/etc/app.conf`)
+}
@@ -0,0 +1,253 @@
+// Package metrics implements the subset of Prometheus metrics used by
+// shoehorn and their text exposition format, without any dependencies.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of histogram buckets in seconds, suited
+// to rendering and writing files
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// Registry holds metric families and writes them in the text format
+type Registry struct {
+	lock     sync.Mutex
+	families []*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// family is a metric and its series, one for each combination of label values
+type family struct {
+	name       string
+	help       string
+	kind       string // "counter", "gauge" or "histogram"
+	labels     []string
+	buckets    []float64
+	series     map[string]*series
+	valueFunc  func() float64 // Computes the value of an unlabelled gauge when written
+	registered *Registry
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64 // Per bucket, for histograms
+	count       uint64
+}
+
+func (r *Registry) register(name, help, kind string, labels []string) *family {
+	f := &family{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labels:     labels,
+		series:     make(map[string]*series),
+		registered: r,
+	}
+	r.lock.Lock()
+	r.families = append(r.families, f)
+	r.lock.Unlock()
+	return f
+}
+
+// get returns the series for labelValues, creating it if needed. The
+// registry lock must be held.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: labelValues, counts: make([]uint64, len(f.buckets))}
+		f.series[key] = s
+	}
+	return s
+}
+
+// CounterVec is a counter with one series for each combination of labels
+type CounterVec struct {
+	family *family
+}
+
+// Counter registers a counter, which only ever increases
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{family: r.register(name, help, "counter", labels)}
+}
+
+// Inc increments the series with the given label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the series with the given label values by value
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	r := c.family.registered
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	c.family.get(labelValues).value += value
+}
+
+// GaugeVec is a gauge with one series for each combination of labels
+type GaugeVec struct {
+	family *family
+}
+
+// Gauge registers a gauge, a value that can go up and down
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{family: r.register(name, help, "gauge", labels)}
+}
+
+// Set sets the series with the given label values to value
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	r := g.family.registered
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	g.family.get(labelValues).value = value
+}
+
+// GaugeFunc registers an unlabelled gauge whose value is computed by f each
+// time the metrics are written
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	r.register(name, help, "gauge", nil).valueFunc = f
+}
+
+// HistogramVec counts observations in buckets, with one series for each
+// combination of labels
+type HistogramVec struct {
+	family *family
+}
+
+// Histogram registers a histogram with the given bucket upper bounds
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	f := r.register(name, help, "histogram", labels)
+	f.buckets = buckets
+	return &HistogramVec{family: f}
+}
+
+// Observe adds value to the series with the given label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	r := h.family.registered
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s := h.family.get(labelValues)
+	for i, bound := range h.family.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.value += value
+	s.count++
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, f := range r.families {
+		fmt.Fprintf(cw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(cw, "# TYPE %s %s\n", f.name, f.kind)
+
+		if f.valueFunc != nil {
+			fmt.Fprintf(cw, "%s %s\n", f.name, formatValue(f.valueFunc()))
+			continue
+		}
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != "histogram" {
+				fmt.Fprintf(cw, "%s%s %s\n", f.name, formatLabels(f.labels, s.labelValues), formatValue(s.value))
+				continue
+			}
+			for i, bound := range f.buckets {
+				labels := formatLabels(slices.Concat(f.labels, []string{"le"}), slices.Concat(s.labelValues, []string{formatValue(bound)}))
+				fmt.Fprintf(cw, "%s_bucket%s %d\n", f.name, labels, s.counts[i])
+			}
+			labels := formatLabels(slices.Concat(f.labels, []string{"le"}), slices.Concat(s.labelValues, []string{"+Inf"}))
+			fmt.Fprintf(cw, "%s_bucket%s %d\n", f.name, labels, s.count)
+			fmt.Fprintf(cw, "%s_sum%s %s\n", f.name, formatLabels(f.labels, s.labelValues), formatValue(s.value))
+			fmt.Fprintf(cw, "%s_count%s %d\n", f.name, formatLabels(f.labels, s.labelValues), s.count)
+		}
+	}
+
+	if cw.err == nil {
+		cw.err = cw.w.(*bufio.Writer).Flush()
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP serves the metrics in the text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
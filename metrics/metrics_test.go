@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryWritesTextFormat(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.Counter("requests_total", "Number of requests", "path", "code")
+	temperature := registry.Gauge("temperature", "Current temperature\nin celsius")
+	duration := registry.Histogram("duration_seconds", "Request duration", []float64{0.1, 1}, "path")
+	registry.GaugeFunc("answer", "The answer", func() float64 { return 42 })
+
+	requests.Inc("/b", "200")
+	requests.Add(2, "/a", "500")
+	requests.Inc("/a", "500")
+	requests.Inc(`/"quoted"`, "200")
+	temperature.Set(-1.5)
+	duration.Observe(0.05, "/a")
+	duration.Observe(0.5, "/a")
+	duration.Observe(2, "/a")
+
+	var sb strings.Builder
+	n, err := registry.WriteTo(&sb)
+	require.NoError(t, err)
+	assert.Equal(t, int64(sb.Len()), n)
+	assert.Equal(t, `# HELP requests_total Number of requests
+# TYPE requests_total counter
+requests_total{path="/\"quoted\"",code="200"} 1
+requests_total{path="/a",code="500"} 3
+requests_total{path="/b",code="200"} 1
+# HELP temperature Current temperature\nin celsius
+# TYPE temperature gauge
+temperature -1.5
+# HELP duration_seconds Request duration
+# TYPE duration_seconds histogram
+duration_seconds_bucket{path="/a",le="0.1"} 1
+duration_seconds_bucket{path="/a",le="1"} 2
+duration_seconds_bucket{path="/a",le="+Inf"} 3
+duration_seconds_sum{path="/a"} 2.55
+duration_seconds_count{path="/a"} 3
+# HELP answer The answer
+# TYPE answer gauge
+answer 42
+`, sb.String())
+}
+
+func TestRegistryServesHTTP(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("events_total", "Number of events").Inc()
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "events_total 1\n")
+}
+
+func TestRegistryPanicsOnWrongLabelCount(t *testing.T) {
+	counter := NewRegistry().Counter("events_total", "Number of events", "kind")
+	assert.Panics(t, func() { counter.Inc() })
+}